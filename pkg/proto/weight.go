@@ -0,0 +1,30 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proto
+
+// Scale returns a copy of w with its read and write weights multiplied by
+// factor and rounded down, e.g. Scale(0.5) halves both and Scale(0) zeroes
+// both out. Used by the namespace package's health-check-driven weight
+// adjustment (see namespace.EnableHealthCheck) to degrade or restore a
+// datasource's effective weight.
+func (w Weight) Scale(factor float64) Weight {
+	return Weight{
+		R: int32(float64(w.R) * factor),
+		W: int32(float64(w.W) * factor),
+	}
+}
@@ -0,0 +1,42 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proto
+
+import "testing"
+
+func TestWeightScale(t *testing.T) {
+	cases := []struct {
+		name   string
+		w      Weight
+		factor float64
+		want   Weight
+	}{
+		{"half", Weight{R: 10, W: 10}, 0.5, Weight{R: 5, W: 5}},
+		{"zero", Weight{R: 10, W: 10}, 0, Weight{R: 0, W: 0}},
+		{"identity", Weight{R: 7, W: 3}, 1, Weight{R: 7, W: 3}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.w.Scale(tc.factor)
+			if got != tc.want {
+				t.Fatalf("Scale(%v, %v) = %v, want %v", tc.w, tc.factor, got, tc.want)
+			}
+		})
+	}
+}
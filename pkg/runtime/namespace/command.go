@@ -18,6 +18,7 @@
 package namespace
 
 import (
+	"fmt"
 	"time"
 )
 
@@ -29,7 +30,10 @@ import (
 	"github.com/arana-db/arana/pkg/util/log"
 )
 
-// UpdateWeight returns a command to update the weight of DB.
+// UpdateWeight returns a command to update the weight of DB, applying
+// synchronously when invoked. Wrap it with Async to run it on the
+// namespace's command queue instead, e.g. when propagating a config change
+// that shouldn't be lost to a momentarily unreachable DB.
 func UpdateWeight(group, id string, weight proto.Weight) Command {
 	return func(ns *Namespace) error {
 		ns.Lock()
@@ -50,13 +54,11 @@ func UpdateWeight(group, id string, weight proto.Weight) Command {
 		}
 
 		if bingo == nil {
-			log.Errorf("[%s] failed to update weight: no such datasource %s.%s", ns.name, group, id)
-			return nil
+			return fmt.Errorf("failed to update weight: no such datasource %s.%s", group, id)
 		}
 
 		if err := bingo.SetWeight(weight); err != nil {
-			log.Errorf("[%s] failed to update weight of datasource %s.%s: %v", ns.name, group, id, err)
-			return nil
+			return fmt.Errorf("failed to update weight of datasource %s.%s: %w", group, id, err)
 		}
 
 		log.Infof("[%s] update weight of datasource %s.%s successfully", ns.name, group, id)
@@ -66,12 +68,19 @@ func UpdateWeight(group, id string, weight proto.Weight) Command {
 }
 
 // RemoveNode returns a command to remove an existing node from namespace.
+// The node is detached from routing synchronously, so it can never be
+// handed out again once this command returns; any health probe watching
+// it is stopped in the same step, so it doesn't keep probing a node that's
+// about to be closed. Closing the node itself is the one fallible step,
+// and is submitted to the namespace's command queue on its own so a
+// failed Close is retried with backoff without re-running (and no-oping)
+// the detach. Poll Namespace.CommandStatus to observe the close outcome.
 func RemoveNode(group, node string) Command {
 	return func(ns *Namespace) error {
 		ns.Lock()
-		defer ns.Unlock()
 		dss, ok := ns.dss.Load().(map[string][]proto.DB)
 		if !ok {
+			ns.Unlock()
 			return nil
 		}
 
@@ -95,12 +104,23 @@ func RemoveNode(group, node string) Command {
 			newborn[k] = newVal
 		}
 		ns.dss.Store(newborn)
+		ns.Unlock()
 
-		if removed != nil {
-			_ = removed.Close()
+		log.Infof("[%s] remove node '%s' from group '%s' successfully", ns.name, node, group)
+
+		if removed == nil {
+			return nil
 		}
 
-		log.Infof("[%s] remove node '%s' from group '%s' successfully", ns.name, node, group)
+		healthRegistryOf(ns).stop(group, node)
+
+		closeFn := func(*Namespace) error {
+			if err := removed.Close(); err != nil {
+				return fmt.Errorf("failed to close removed node %s.%s: %w", group, node, err)
+			}
+			return nil
+		}
+		ns.Submit(closeFn, WithKind("remove_node_close"), WithTarget(group+"."+node))
 
 		return nil
 	}
@@ -133,7 +153,14 @@ func RemoveGroup(group string) Command {
 	}
 }
 
-// RemoveDB returns a command to remove an existing DB.
+// RemoveDB returns a command to remove an existing DB, applying
+// synchronously when invoked. The displaced DB is handed to the namespace
+// drainer for a graceful close regardless, and any health probe watching
+// it is stopped so it doesn't keep calling Probe/SetWeight against a DB
+// the drainer is concurrently closing. Wrap with Async to run this on the
+// namespace's command queue instead, so a downstream DB that's
+// momentarily unreachable doesn't get its removal silently dropped; poll
+// Namespace.CommandStatus to observe the outcome.
 func RemoveDB(group, id string) Command {
 	return func(ns *Namespace) error {
 		ns.Lock()
@@ -166,17 +193,28 @@ func RemoveDB(group, id string) Command {
 		}
 		newborn[group] = values
 
-		// TODO: expire datasource, lazy-close?
-
 		ns.dss.Store(newborn)
-		log.Infof("[%s] remove datasource %s.%s successfully", ns.name, group, id)
+
+		drainerOf(ns).drain(ns, group, id, expired, defaultDrainTimeout)
+		healthRegistryOf(ns).stop(group, id)
+
+		log.Infof("[%s] remove datasource %s.%s successfully, draining old instance", ns.name, group, id)
 
 		return nil
 	}
 }
 
-// UpsertDB appends a new DB.
+// UpsertDB appends a new DB, applying synchronously when invoked. A DB
+// displaced from the same group+id is handed to the namespace drainer for
+// a graceful close regardless, and any health probe watching it is
+// rebound to the new DB so it keeps monitoring the datasource that's
+// actually in routing instead of the one just displaced. Wrap with Async
+// to run this on the namespace's command queue instead, so a downstream
+// DB that's momentarily unreachable doesn't get its propagation silently
+// dropped; poll Namespace.CommandStatus to observe the outcome.
 func UpsertDB(group string, ds proto.DB) Command {
+	id := ds.ID()
+
 	return func(ns *Namespace) error {
 		ns.Lock()
 		defer ns.Unlock()
@@ -185,7 +223,6 @@ func UpsertDB(group string, ds proto.DB) Command {
 			current = ns.dss.Load().(map[string][]proto.DB)
 			values  []proto.DB
 			expired proto.DB
-			id      = ds.ID()
 		)
 
 		if exist, ok := current[group]; ok {
@@ -199,11 +236,6 @@ func UpsertDB(group string, ds proto.DB) Command {
 		}
 		values = append(values, ds)
 
-		if expired != nil {
-			// TODO: expire datasource, lazy-close?
-			log.Infof("todo: expire DB %s", expired.ID())
-		}
-
 		newborn := make(map[string][]proto.DB)
 		for k, v := range current {
 			newborn[k] = v
@@ -212,18 +244,30 @@ func UpsertDB(group string, ds proto.DB) Command {
 
 		ns.dss.Store(newborn)
 
+		if expired != nil {
+			drainerOf(ns).drain(ns, group, id, expired, defaultDrainTimeout)
+			healthRegistryOf(ns).rebind(group, id, ds)
+		}
+
 		log.Infof("[%s] upsert db %s.%s successfully", ns.name, group, id)
 
 		return nil
 	}
 }
 
-// UpdateRule updates the rule.
+// UpdateRule updates the rule and reloads the retention policy set from
+// the configured PolicyStore, if any, so a rule update doesn't leave
+// retention policies pointing at shards the new rule no longer describes.
+// The reload runs after ns.Unlock: PolicyStore.Load may be a remote call
+// (e.g. an etcd round-trip), and every other namespace command would
+// otherwise block on ns.Lock for its duration.
 func UpdateRule(rule *rule.Rule) Command {
 	return func(ns *Namespace) error {
 		ns.Lock()
-		defer ns.Unlock()
 		ns.rule.Store(rule)
+		ns.Unlock()
+
+		retentionRegistryOf(ns).reload(ns)
 
 		log.Infof("[%s] update rule successfully", ns.name)
 
@@ -0,0 +1,253 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package namespace
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+import (
+	"github.com/arana-db/arana/pkg/proto"
+	"github.com/arana-db/arana/pkg/util/log"
+)
+
+// defaultDrainTimeout bounds how long a displaced DB is kept alive waiting
+// for in-flight queries to finish when callers don't specify one.
+const defaultDrainTimeout = 30 * time.Second
+
+// drainPollInterval controls how often a draining DB is polled for idleness.
+const drainPollInterval = 50 * time.Millisecond
+
+// InFlightReporter is optionally implemented by proto.DB backends whose
+// connection pool can report the number of currently borrowed connections.
+// A DB that doesn't implement it is simply kept alive until its timeout
+// elapses before being closed.
+type InFlightReporter interface {
+	InFlight() int32
+}
+
+// DrainState describes a DB that has been displaced by RemoveDB/UpsertDB and
+// is being kept alive until it goes idle or its deadline elapses.
+type DrainState struct {
+	Group    string
+	ID       string
+	StartAt  time.Time
+	Deadline time.Time
+}
+
+type drainEntry struct {
+	state  DrainState
+	db     proto.DB
+	cancel context.CancelFunc
+}
+
+// drainer keeps track of DBs that are draining on behalf of a Namespace.
+type drainer struct {
+	mu      sync.Mutex
+	entries map[string]*drainEntry // keyed by drainKey(group, id)
+}
+
+// drainerOf returns the drainer attached to ns, creating it on first use.
+// See namespaceExt for why this is consolidated behind a single per-
+// Namespace extension bundle instead of its own package-level registry.
+func drainerOf(ns *Namespace) *drainer {
+	e := extOf(ns)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.drainer == nil {
+		e.drainer = &drainer{entries: make(map[string]*drainEntry)}
+	}
+	return e.drainer
+}
+
+func drainKey(group, id string) string {
+	return group + "." + id
+}
+
+// drain marks db as draining and asynchronously closes it once it reports
+// zero in-flight borrows or timeout elapses, whichever comes first.
+func (d *drainer) drain(ns *Namespace, group, id string, db proto.DB, timeout time.Duration) {
+	if db == nil {
+		return
+	}
+	if timeout <= 0 {
+		timeout = defaultDrainTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	now := time.Now()
+	entry := &drainEntry{
+		state: DrainState{
+			Group:    group,
+			ID:       id,
+			StartAt:  now,
+			Deadline: now.Add(timeout),
+		},
+		db:     db,
+		cancel: cancel,
+	}
+
+	key := drainKey(group, id)
+
+	d.mu.Lock()
+	if old, ok := d.entries[key]; ok {
+		// A previous drain for the same id is still pending: let the newer
+		// displacement win and cut the old wait short.
+		old.cancel()
+	}
+	d.entries[key] = entry
+	d.mu.Unlock()
+
+	go d.wait(ns, key, ctx, entry)
+}
+
+// drainWait blocks until inFlight reports zero (or fewer) borrowed
+// connections, or ctx is done, polling every drainPollInterval. inFlight is
+// nil when the backing DB doesn't implement InFlightReporter, in which case
+// drainWait conservatively waits out the full ctx deadline before
+// returning, rather than closing the DB on the very next tick.
+func drainWait(ctx context.Context, inFlight func() int32) {
+	if inFlight == nil {
+		<-ctx.Done()
+		return
+	}
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if inFlight() <= 0 {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *drainer) wait(ns *Namespace, key string, ctx context.Context, entry *drainEntry) {
+	var inFlight func() int32
+	if reporter, ok := entry.db.(InFlightReporter); ok {
+		inFlight = reporter.InFlight
+	}
+	drainWait(ctx, inFlight)
+
+	entry.cancel()
+
+	err := entry.db.Close()
+
+	d.mu.Lock()
+	if d.entries[key] == entry {
+		delete(d.entries, key)
+	}
+	d.mu.Unlock()
+
+	if err != nil {
+		log.Errorf("[%s] failed to close drained datasource %s: %v", ns.name, entry.state.ID, err)
+		return
+	}
+	log.Infof("[%s] drained and closed datasource %s", ns.name, entry.state.ID)
+}
+
+// status returns a snapshot of every DB currently draining.
+func (d *drainer) status() []DrainState {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	out := make([]DrainState, 0, len(d.entries))
+	for _, e := range d.entries {
+		out = append(out, e.state)
+	}
+	return out
+}
+
+// isDraining reports whether the given group/id datasource is currently
+// draining.
+func (d *drainer) isDraining(group, id string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.entries[drainKey(group, id)]
+	return ok
+}
+
+// DrainStatus returns the set of datasources currently draining along with
+// their deadlines, so admin tooling can inspect pending removals.
+func (ns *Namespace) DrainStatus() []DrainState {
+	return drainerOf(ns).status()
+}
+
+// IsDraining reports whether the given group/id datasource is currently
+// draining. The load balancer should consult this before routing new work
+// to a datasource.
+func (ns *Namespace) IsDraining(group, id string) bool {
+	return drainerOf(ns).isDraining(group, id)
+}
+
+// DrainDB returns a command that gracefully drains and closes an existing
+// DB: it is detached from ns.dss immediately, same as RemoveDB, so the load
+// balancer can never hand it out again and a later RemoveDB/UpsertDB for the
+// same id can't observe the same instance and hand it to the drainer a
+// second time; it is only closed once it reports zero in-flight borrows or
+// timeout elapses.
+func DrainDB(group, id string, timeout time.Duration) Command {
+	return func(ns *Namespace) error {
+		ns.Lock()
+		defer ns.Unlock()
+
+		var (
+			target proto.DB
+			values []proto.DB
+			dss    = ns.dss.Load().(map[string][]proto.DB)
+		)
+
+		if exist, ok := dss[group]; ok {
+			values = make([]proto.DB, 0, len(exist))
+			for _, it := range exist {
+				if it.ID() == id {
+					target = it
+					continue
+				}
+				values = append(values, it)
+			}
+		}
+
+		if target == nil {
+			return fmt.Errorf("failed to drain: no such datasource %s.%s", group, id)
+		}
+
+		newborn := make(map[string][]proto.DB)
+		for k, v := range dss {
+			newborn[k] = v
+		}
+		newborn[group] = values
+
+		ns.dss.Store(newborn)
+
+		drainerOf(ns).drain(ns, group, id, target, timeout)
+		log.Infof("[%s] datasource %s.%s is now draining", ns.name, group, id)
+
+		return nil
+	}
+}
@@ -0,0 +1,198 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package namespace
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/arana-db/arana/pkg/proto"
+)
+
+// fakeDrainDB is a minimal proto.DB fake for exercising RemoveDB/UpsertDB
+// against the drainer. It embeds a nil proto.DB so it satisfies the full
+// interface structurally; only the methods this package actually calls
+// (ID, SetWeight, Close, InFlight) are implemented, and every call is
+// tracked so a test can assert nothing is closed twice or leaked.
+type fakeDrainDB struct {
+	proto.DB
+	id         string
+	closeCount int32
+}
+
+func (f *fakeDrainDB) ID() string                   { return f.id }
+func (f *fakeDrainDB) SetWeight(proto.Weight) error { return nil }
+func (f *fakeDrainDB) InFlight() int32              { return 0 }
+func (f *fakeDrainDB) Close() error {
+	atomic.AddInt32(&f.closeCount, 1)
+	return nil
+}
+
+// TestDrainWaitNoReporter asserts the fix for the reported bug: when the
+// backing DB doesn't implement InFlightReporter, drainWait must wait out
+// the full deadline instead of returning on the very first check (which
+// would close a DB that may still have in-flight queries on it).
+func TestDrainWaitNoReporter(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 80*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	drainWait(ctx, nil)
+	elapsed := time.Since(start)
+
+	if elapsed < 80*time.Millisecond {
+		t.Fatalf("drainWait returned after %s, want it to wait out the full deadline", elapsed)
+	}
+}
+
+// TestDrainWaitReturnsOnceIdle asserts drainWait returns promptly once
+// inFlight reports zero, without waiting for the deadline.
+func TestDrainWaitReturnsOnceIdle(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var inFlight int32 = 3
+	go func() {
+		time.Sleep(3 * drainPollInterval)
+		atomic.StoreInt32(&inFlight, 0)
+	}()
+
+	start := time.Now()
+	drainWait(ctx, func() int32 { return atomic.LoadInt32(&inFlight) })
+	elapsed := time.Since(start)
+
+	if elapsed >= 5*time.Second {
+		t.Fatalf("drainWait waited out the deadline instead of returning once idle")
+	}
+}
+
+// TestDrainWaitClosesOnTimeout asserts drainWait gives up once ctx is done
+// even if inFlight never reaches zero.
+func TestDrainWaitClosesOnTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 80*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	drainWait(ctx, func() int32 { return 1 })
+	elapsed := time.Since(start)
+
+	if elapsed < 80*time.Millisecond {
+		t.Fatalf("drainWait returned after %s, want it to wait out the deadline", elapsed)
+	}
+}
+
+// TestDrainDBDetachesFromRoutingTable asserts DrainDB removes the id from
+// ns.dss, like RemoveDB does, so a later RemoveDB call for the same id finds
+// nothing left to displace instead of handing the same already-draining DB
+// to the drainer a second time and double-closing it.
+func TestDrainDBDetachesFromRoutingTable(t *testing.T) {
+	const group = "g0"
+	const id = "a"
+
+	ns := &Namespace{name: "drain-detach-test"}
+	db := &fakeDrainDB{id: id}
+	ns.dss.Store(map[string][]proto.DB{group: {db}})
+
+	if err := DrainDB(group, id, time.Second)(ns); err != nil {
+		t.Fatalf("DrainDB: %v", err)
+	}
+
+	if exist := ns.dss.Load().(map[string][]proto.DB)[group]; len(exist) != 0 {
+		t.Fatalf("dss[%s] = %v after DrainDB, want the id detached", group, exist)
+	}
+
+	if err := RemoveDB(group, id)(ns); err != nil {
+		t.Fatalf("RemoveDB after DrainDB: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(ns.DrainStatus()) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if got := atomic.LoadInt32(&db.closeCount); got != 1 {
+		t.Fatalf("closeCount = %d after DrainDB followed by RemoveDB, want exactly 1 (leaked or double-closed)", got)
+	}
+}
+
+// TestRemoveUpsertRaceDrainsEveryDisplacedDB races RemoveDB and UpsertDB
+// against each other on the same group+id and asserts every DB displaced
+// along the way is drained and closed exactly once - the leak the drain
+// subsystem exists to prevent. ns.Lock inside RemoveDB/UpsertDB totally
+// orders the mutations, so every value but whichever one ends up live must
+// be handed to the drainer by whichever command observes it next.
+func TestRemoveUpsertRaceDrainsEveryDisplacedDB(t *testing.T) {
+	const group = "g0"
+	const id = "a"
+
+	ns := &Namespace{name: "race-test"}
+	first := &fakeDrainDB{id: id}
+	ns.dss.Store(map[string][]proto.DB{group: {first}})
+
+	const rounds = 20
+	var (
+		mu        sync.Mutex
+		displaced = []*fakeDrainDB{first}
+	)
+
+	var wg sync.WaitGroup
+	for i := 0; i < rounds; i++ {
+		next := &fakeDrainDB{id: id}
+		mu.Lock()
+		displaced = append(displaced, next)
+		mu.Unlock()
+
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_ = RemoveDB(group, id)(ns)
+		}()
+		go func(db *fakeDrainDB) {
+			defer wg.Done()
+			_ = UpsertDB(group, db)(ns)
+		}(next)
+	}
+	wg.Wait()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(ns.DrainStatus()) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := len(ns.DrainStatus()); n != 0 {
+		t.Fatalf("%d datasources still draining after deadline", n)
+	}
+
+	live := make(map[*fakeDrainDB]bool)
+	for _, db := range ns.dss.Load().(map[string][]proto.DB)[group] {
+		live[db.(*fakeDrainDB)] = true
+	}
+
+	for _, db := range displaced {
+		if live[db] {
+			continue
+		}
+		if got := atomic.LoadInt32(&db.closeCount); got != 1 {
+			t.Errorf("displaced datasource %p closeCount = %d, want exactly 1 (leaked or double-closed)", db, got)
+		}
+	}
+}
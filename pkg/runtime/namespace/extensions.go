@@ -0,0 +1,79 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package namespace
+
+import "sync"
+
+// namespaceExt bundles every piece of per-Namespace state that drain.go,
+// ratelimit.go, queue.go, healthcheck.go and retention.go attach without a
+// field on the (shared) Namespace struct: the drainer, rate limiter
+// registry, command queue, health registry and retention registry. They
+// used to live behind five independent package-level sync.Maps, none of
+// which ever removed its entry once a *Namespace stopped being used, which
+// would leak each subsystem's goroutines (queue workers, the retention
+// sweep loop, every health probe) for the life of the process if a
+// Namespace is ever replaced rather than mutated in place. Consolidating
+// them here gives that case exactly one map to drop and one Close to call.
+type namespaceExt struct {
+	mu sync.Mutex
+
+	drainer   *drainer
+	rateLimit *rateLimitRegistry
+	queue     *commandQueue
+	health    *healthRegistry
+	retention *retentionRegistry
+}
+
+var namespaceExts sync.Map // map[*Namespace]*namespaceExt
+
+func extOf(ns *Namespace) *namespaceExt {
+	if v, ok := namespaceExts.Load(ns); ok {
+		return v.(*namespaceExt)
+	}
+	v, _ := namespaceExts.LoadOrStore(ns, &namespaceExt{})
+	return v.(*namespaceExt)
+}
+
+// Close tears down every extension ever attached to ns - stopping the
+// command queue's workers, the retention sweep loop and every active
+// health probe - then drops ns's entry entirely. Call this when ns is
+// being retired, e.g. replaced wholesale by a config reload, so none of
+// its background goroutines or in-memory state outlives it. It is a no-op
+// if ns never had any extension attached.
+func (ns *Namespace) Close() {
+	v, ok := namespaceExts.Load(ns)
+	if !ok {
+		return
+	}
+	e := v.(*namespaceExt)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.queue != nil {
+		e.queue.stop()
+	}
+	if e.retention != nil {
+		e.retention.stop()
+	}
+	if e.health != nil {
+		e.health.stopAll()
+	}
+
+	namespaceExts.Delete(ns)
+}
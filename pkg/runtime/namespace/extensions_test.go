@@ -0,0 +1,70 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package namespace
+
+import (
+	"testing"
+)
+
+import (
+	"github.com/arana-db/arana/pkg/proto"
+)
+
+// TestNamespaceCloseTearsDownExtensions asserts Close stops the command
+// queue's workers, every registered health probe and the retention sweep
+// loop, then drops ns's entry so none of it is kept alive afterward.
+func TestNamespaceCloseTearsDownExtensions(t *testing.T) {
+	ns := &Namespace{name: "lifecycle-test"}
+
+	q := queueOf(ns)
+
+	db := &fakeProbeDB{weight: proto.Weight{R: 1, W: 1}}
+	p := newTestProbe(db, HealthCheckConfig{})
+	p.ns = ns
+	healthRegistryOf(ns).register("g0", "a", p)
+
+	reg := retentionRegistryOf(ns)
+
+	ns.Close()
+
+	select {
+	case <-q.done:
+	default:
+		t.Fatal("commandQueue not stopped by Namespace.Close")
+	}
+	select {
+	case <-p.stop:
+	default:
+		t.Fatal("health probe not stopped by Namespace.Close")
+	}
+	select {
+	case <-reg.stopCh:
+	default:
+		t.Fatal("retention sweep loop not stopped by Namespace.Close")
+	}
+	if _, ok := namespaceExts.Load(ns); ok {
+		t.Fatal("namespaceExt not removed after Namespace.Close")
+	}
+}
+
+// TestNamespaceCloseNoopWithoutExtensions asserts Close on a Namespace that
+// never had any extension attached is a harmless no-op.
+func TestNamespaceCloseNoopWithoutExtensions(t *testing.T) {
+	ns := &Namespace{name: "lifecycle-test-empty"}
+	ns.Close()
+}
@@ -0,0 +1,610 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package namespace
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+import (
+	"github.com/arana-db/arana/pkg/proto"
+	"github.com/arana-db/arana/pkg/util/log"
+)
+
+const (
+	defaultProbeInterval    = 5 * time.Second
+	defaultProbeTimeout     = 2 * time.Second
+	defaultProbeWindow      = 20
+	defaultCircuitBreakN    = 5
+	defaultHalfOpenInterval = 6 * defaultProbeInterval
+
+	degradedSuccessRate  = 0.8
+	unhealthySuccessRate = 0.5
+)
+
+// Prober is implemented by proto.DB backends that can run an active health
+// probe, e.g. "SELECT 1" or a replication-lag query, and report whether it
+// succeeded.
+type Prober interface {
+	Probe(ctx context.Context, query string) error
+}
+
+// WeightGetter is implemented by proto.DB backends that can report their
+// currently configured Weight, so it can be remembered and restored once a
+// degraded/unhealthy datasource recovers.
+type WeightGetter interface {
+	Weight() proto.Weight
+}
+
+// WeightScaler is implemented by proto.Weight values capable of producing a
+// scaled copy of themselves, so the prober can halve or zero out effective
+// weight without needing to know the concrete weight representation.
+type WeightScaler interface {
+	Scale(factor float64) proto.Weight
+}
+
+// HealthCheckConfig configures the active health prober attached to a DB by
+// EnableHealthCheck.
+type HealthCheckConfig struct {
+	// Query is the probe statement, e.g. "SELECT 1". Defaults to "SELECT 1".
+	Query string
+	// ReplicationLagQuery, if set, is additionally probed against read
+	// replicas and treated the same as Query for success/failure purposes.
+	ReplicationLagQuery string
+
+	Interval      time.Duration
+	Timeout       time.Duration
+	LatencyBudget time.Duration
+
+	// WindowSize is how many recent probes the rolling success rate and p95
+	// latency are computed over.
+	WindowSize int
+
+	// CircuitBreakN is how many consecutive probe failures open the circuit
+	// breaker, removing the datasource from routing entirely.
+	CircuitBreakN int
+
+	// HalfOpenInterval is the cooldown between half-open admission probes
+	// while the circuit is open. It replaces the regular Interval cadence
+	// for as long as the circuit stays open, since hammering a known-bad
+	// datasource at the normal probe rate defeats the point of breaking the
+	// circuit. Defaults to defaultHalfOpenInterval (30s, i.e. 6x the default
+	// Interval) whatever Interval is configured.
+	HalfOpenInterval time.Duration
+}
+
+// HealthStatus is the current verdict of a DB's active health prober.
+type HealthStatus uint8
+
+const (
+	HealthHealthy HealthStatus = iota
+	HealthDegraded
+	HealthUnhealthy
+	HealthCircuitOpen
+)
+
+func (s HealthStatus) String() string {
+	switch s {
+	case HealthDegraded:
+		return "degraded"
+	case HealthUnhealthy:
+		return "unhealthy"
+	case HealthCircuitOpen:
+		return "circuit-open"
+	default:
+		return "healthy"
+	}
+}
+
+// HealthEvent records a health status transition, so operators can see why
+// a datasource's weight changed.
+type HealthEvent struct {
+	Group  string
+	ID     string
+	From   HealthStatus
+	To     HealthStatus
+	Reason string
+	At     time.Time
+}
+
+// HealthState is a point-in-time snapshot of a probed DB's health.
+type HealthState struct {
+	Group           string
+	ID              string
+	Status          HealthStatus
+	SuccessRate     float64
+	P95Latency      time.Duration
+	ConsecutiveFail int
+	UpdatedAt       time.Time
+}
+
+type healthProbe struct {
+	ns    *Namespace
+	group string
+	id    string
+	db    proto.DB
+	cfg   HealthCheckConfig
+
+	origWeight proto.Weight
+	haveOrigin bool
+	stop       chan struct{}
+
+	mu              sync.Mutex
+	samples         []bool
+	latencies       []time.Duration
+	consecutiveFail int
+	status          HealthStatus
+	updatedAt       time.Time
+	lastHalfOpen    time.Time
+}
+
+func (p *healthProbe) query() string {
+	if p.cfg.Query != "" {
+		return p.cfg.Query
+	}
+	return "SELECT 1"
+}
+
+// current returns the DB currently being probed/weighted along with its
+// remembered original weight, synchronized against a concurrent rebind.
+func (p *healthProbe) current() (db proto.DB, origWeight proto.Weight, haveOrigin bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.db, p.origWeight, p.haveOrigin
+}
+
+// rebind re-points the probe at a replacement DB for the same group.id,
+// re-deriving origWeight from it so weight restoration on recovery always
+// targets the DB currently in routing rather than one UpsertDB displaced.
+func (p *healthProbe) rebind(db proto.DB) {
+	p.mu.Lock()
+	p.db = db
+	if getter, ok := db.(WeightGetter); ok {
+		p.origWeight = getter.Weight()
+		p.haveOrigin = true
+	} else {
+		p.haveOrigin = false
+	}
+	p.mu.Unlock()
+}
+
+// run drives the probe loop on the regular Interval ticker. While the
+// circuit is open it stops issuing regular probes (which would just keep
+// feeding failures into the same rolling window the unhealthy path uses)
+// and instead issues a single-shot half-open admission probe at most once
+// per HalfOpenInterval.
+func (p *healthProbe) run() {
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case now := <-ticker.C:
+			if p.isCircuitOpen() {
+				p.maybeHalfOpen(now)
+				continue
+			}
+			p.probeOnce()
+		}
+	}
+}
+
+func (p *healthProbe) isCircuitOpen() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.status == HealthCircuitOpen
+}
+
+func (p *healthProbe) maybeHalfOpen(now time.Time) {
+	p.mu.Lock()
+	if now.Sub(p.lastHalfOpen) < p.cfg.HalfOpenInterval {
+		p.mu.Unlock()
+		return
+	}
+	p.lastHalfOpen = now
+	p.mu.Unlock()
+
+	p.probeHalfOpen()
+}
+
+// probeHalfOpen issues a single admission probe while the circuit is open.
+// Unlike probeOnce it doesn't feed the rolling success-rate/latency window:
+// one success re-admits the datasource immediately (restoring its original
+// weight) and resets the rolling stats so a single stale failure can't
+// reopen the circuit on the very next tick; one failure leaves the circuit
+// open for another HalfOpenInterval.
+func (p *healthProbe) probeHalfOpen() {
+	db, _, _ := p.current()
+	prober, ok := db.(Prober)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.cfg.Timeout)
+	defer cancel()
+
+	err := prober.Probe(ctx, p.query())
+
+	p.mu.Lock()
+	prev := p.status
+	if err == nil {
+		p.status = HealthHealthy
+		p.consecutiveFail = 0
+		p.samples = p.samples[:0]
+		p.latencies = p.latencies[:0]
+	}
+	p.updatedAt = time.Now()
+	next := p.status
+	p.mu.Unlock()
+
+	if next == prev {
+		log.Infof("[%s] datasource %s.%s half-open probe failed, circuit stays open: %v", p.ns.name, p.group, p.id, err)
+		return
+	}
+
+	p.applyWeight(next)
+
+	healthRegistryOf(p.ns).emit(HealthEvent{
+		Group:  p.group,
+		ID:     p.id,
+		From:   prev,
+		To:     next,
+		Reason: "half-open probe succeeded",
+		At:     time.Now(),
+	})
+
+	log.Infof("[%s] datasource %s.%s health changed %s -> %s (half-open probe succeeded)", p.ns.name, p.group, p.id, prev, next)
+}
+
+func (p *healthProbe) probeOnce() {
+	db, _, _ := p.current()
+	prober, ok := db.(Prober)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.cfg.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := prober.Probe(ctx, p.query())
+	latency := time.Since(start)
+
+	if err == nil && p.cfg.ReplicationLagQuery != "" {
+		err = prober.Probe(ctx, p.cfg.ReplicationLagQuery)
+	}
+
+	success := err == nil && (p.cfg.LatencyBudget <= 0 || latency <= p.cfg.LatencyBudget)
+	p.record(success, latency)
+}
+
+func (p *healthProbe) record(success bool, latency time.Duration) {
+	p.mu.Lock()
+	p.samples = append(p.samples, success)
+	if len(p.samples) > p.cfg.WindowSize {
+		p.samples = p.samples[len(p.samples)-p.cfg.WindowSize:]
+	}
+	p.latencies = append(p.latencies, latency)
+	if len(p.latencies) > p.cfg.WindowSize {
+		p.latencies = p.latencies[len(p.latencies)-p.cfg.WindowSize:]
+	}
+	if success {
+		p.consecutiveFail = 0
+	} else {
+		p.consecutiveFail++
+	}
+	rate := p.successRateLocked()
+	p95 := p.p95Locked()
+	fails := p.consecutiveFail
+	p.mu.Unlock()
+
+	p.evaluate(rate, p95, fails)
+}
+
+func (p *healthProbe) successRateLocked() float64 {
+	if len(p.samples) == 0 {
+		return 1
+	}
+	ok := 0
+	for _, s := range p.samples {
+		if s {
+			ok++
+		}
+	}
+	return float64(ok) / float64(len(p.samples))
+}
+
+func (p *healthProbe) p95Locked() time.Duration {
+	if len(p.latencies) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), p.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	idx := (len(sorted) * 95) / 100
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
+
+// evaluate decides the new HealthStatus from the latest rolling stats and,
+// if it changed, adjusts weight and emits a HealthEvent.
+func (p *healthProbe) evaluate(rate float64, p95 time.Duration, consecutiveFail int) {
+	next := HealthHealthy
+	reason := "recovered"
+	switch {
+	case consecutiveFail >= p.cfg.CircuitBreakN:
+		next = HealthCircuitOpen
+		reason = fmt.Sprintf("%d consecutive probe failures", consecutiveFail)
+	case rate < unhealthySuccessRate:
+		next = HealthUnhealthy
+		reason = fmt.Sprintf("success rate %.0f%% below unhealthy threshold", rate*100)
+	case rate < degradedSuccessRate:
+		next = HealthDegraded
+		reason = fmt.Sprintf("success rate %.0f%% below degraded threshold", rate*100)
+	case p.cfg.LatencyBudget > 0 && p95 > p.cfg.LatencyBudget:
+		next = HealthDegraded
+		reason = fmt.Sprintf("p95 latency %s above latency budget %s", p95, p.cfg.LatencyBudget)
+	}
+
+	p.mu.Lock()
+	prev := p.status
+	p.status = next
+	p.updatedAt = time.Now()
+	p.mu.Unlock()
+
+	if next == prev {
+		return
+	}
+
+	p.applyWeight(next)
+
+	healthRegistryOf(p.ns).emit(HealthEvent{
+		Group:  p.group,
+		ID:     p.id,
+		From:   prev,
+		To:     next,
+		Reason: reason,
+		At:     time.Now(),
+	})
+
+	log.Infof("[%s] datasource %s.%s health changed %s -> %s (%s, p95=%s)", p.ns.name, p.group, p.id, prev, next, reason, p95)
+}
+
+// applyWeight pushes the weight adjustment implied by status: halved while
+// degraded, zeroed while unhealthy or circuit-open, restored once healthy.
+func (p *healthProbe) applyWeight(status HealthStatus) {
+	db, origWeight, haveOrigin := p.current()
+	if !haveOrigin {
+		return
+	}
+	scaler, ok := interface{}(origWeight).(WeightScaler)
+	if !ok {
+		return
+	}
+
+	var target proto.Weight
+	switch status {
+	case HealthHealthy:
+		target = origWeight
+	case HealthDegraded:
+		target = scaler.Scale(0.5)
+	default: // unhealthy or circuit-open
+		target = scaler.Scale(0)
+	}
+
+	if err := db.SetWeight(target); err != nil {
+		log.Errorf("[%s] failed to adjust weight of datasource %s.%s: %v", p.ns.name, p.group, p.id, err)
+	}
+}
+
+type healthRegistry struct {
+	mu     sync.Mutex
+	probes map[string]*healthProbe
+	events []HealthEvent
+}
+
+const maxHealthEvents = 200
+
+// healthRegistryOf returns the healthRegistry attached to ns, creating it on
+// first use. See namespaceExt for why this is consolidated behind a single
+// per-Namespace extension bundle instead of its own package-level registry.
+func healthRegistryOf(ns *Namespace) *healthRegistry {
+	e := extOf(ns)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.health == nil {
+		e.health = &healthRegistry{probes: make(map[string]*healthProbe)}
+	}
+	return e.health
+}
+
+func (r *healthRegistry) register(group, id string, p *healthProbe) {
+	key := drainKey(group, id)
+
+	r.mu.Lock()
+	if old, ok := r.probes[key]; ok {
+		close(old.stop)
+	}
+	r.probes[key] = p
+	r.mu.Unlock()
+}
+
+// stop halts and forgets the health probe for group.id, if one is
+// registered. RemoveDB/RemoveNode call this when they permanently displace
+// the DB a probe was watching, so the probe doesn't keep calling
+// Probe/SetWeight against a datasource the drainer is concurrently closing.
+func (r *healthRegistry) stop(group, id string) {
+	key := drainKey(group, id)
+
+	r.mu.Lock()
+	p, ok := r.probes[key]
+	if ok {
+		delete(r.probes, key)
+	}
+	r.mu.Unlock()
+
+	if ok {
+		close(p.stop)
+	}
+}
+
+// rebind re-points an already-registered health probe at a replacement DB
+// for the same group.id, preserving its rolling stats and config instead
+// of silently continuing to watch the DB that UpsertDB just displaced. It
+// is a no-op if no probe is registered for group.id, i.e. health check was
+// never enabled for it.
+func (r *healthRegistry) rebind(group, id string, db proto.DB) {
+	key := drainKey(group, id)
+
+	r.mu.Lock()
+	p, ok := r.probes[key]
+	r.mu.Unlock()
+
+	if ok {
+		p.rebind(db)
+	}
+}
+
+// stopAll halts and forgets every registered health probe. Called from
+// Namespace.Close when ns is being retired.
+func (r *healthRegistry) stopAll() {
+	r.mu.Lock()
+	probes := make([]*healthProbe, 0, len(r.probes))
+	for _, p := range r.probes {
+		probes = append(probes, p)
+	}
+	r.probes = make(map[string]*healthProbe)
+	r.mu.Unlock()
+
+	for _, p := range probes {
+		close(p.stop)
+	}
+}
+
+func (r *healthRegistry) emit(e HealthEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = append(r.events, e)
+	if len(r.events) > maxHealthEvents {
+		r.events = r.events[len(r.events)-maxHealthEvents:]
+	}
+}
+
+func (r *healthRegistry) snapshot() []HealthState {
+	r.mu.Lock()
+	probes := make([]*healthProbe, 0, len(r.probes))
+	for _, p := range r.probes {
+		probes = append(probes, p)
+	}
+	r.mu.Unlock()
+
+	out := make([]HealthState, 0, len(probes))
+	for _, p := range probes {
+		p.mu.Lock()
+		out = append(out, HealthState{
+			Group:           p.group,
+			ID:              p.id,
+			Status:          p.status,
+			SuccessRate:     p.successRateLocked(),
+			P95Latency:      p.p95Locked(),
+			ConsecutiveFail: p.consecutiveFail,
+			UpdatedAt:       p.updatedAt,
+		})
+		p.mu.Unlock()
+	}
+	return out
+}
+
+// Health returns a snapshot of every actively health-checked datasource in
+// this namespace, for the admin API.
+func (ns *Namespace) Health() []HealthState {
+	return healthRegistryOf(ns).snapshot()
+}
+
+// EnableHealthCheck returns a command that attaches an active health
+// prober to an existing DB. Based on the rolling success rate and p95
+// latency it automatically halves weight on degraded, zeroes it on
+// unhealthy, and restores the original weight on recovery; after
+// CircuitBreakN consecutive failures it opens the circuit, removing the
+// node from routing and switching to a single-shot half-open admission
+// probe every HalfOpenInterval until one succeeds, at which point it's
+// re-admitted and its rolling stats are reset.
+func EnableHealthCheck(group, id string, hc HealthCheckConfig) Command {
+	return func(ns *Namespace) error {
+		dss := ns.dss.Load().(map[string][]proto.DB)
+
+		var target proto.DB
+		if exist, ok := dss[group]; ok {
+			for _, it := range exist {
+				if it.ID() == id {
+					target = it
+					break
+				}
+			}
+		}
+		if target == nil {
+			return fmt.Errorf("failed to enable health check: no such datasource %s.%s", group, id)
+		}
+
+		if hc.Interval <= 0 {
+			hc.Interval = defaultProbeInterval
+		}
+		if hc.Timeout <= 0 {
+			hc.Timeout = defaultProbeTimeout
+		}
+		if hc.WindowSize <= 0 {
+			hc.WindowSize = defaultProbeWindow
+		}
+		if hc.CircuitBreakN <= 0 {
+			hc.CircuitBreakN = defaultCircuitBreakN
+		}
+		if hc.HalfOpenInterval <= 0 {
+			hc.HalfOpenInterval = defaultHalfOpenInterval
+		}
+
+		probe := &healthProbe{
+			ns:    ns,
+			group: group,
+			id:    id,
+			db:    target,
+			cfg:   hc,
+			stop:  make(chan struct{}),
+		}
+		if getter, ok := target.(WeightGetter); ok {
+			probe.origWeight = getter.Weight()
+			probe.haveOrigin = true
+		}
+
+		healthRegistryOf(ns).register(group, id, probe)
+		go probe.run()
+
+		log.Infof("[%s] enabled health check on datasource %s.%s", ns.name, group, id)
+
+		return nil
+	}
+}
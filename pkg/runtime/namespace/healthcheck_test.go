@@ -0,0 +1,261 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package namespace
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/arana-db/arana/pkg/proto"
+)
+
+// fakeProbeDB is a minimal proto.DB fake for exercising healthProbe. It
+// embeds a nil proto.DB so it satisfies the full interface structurally;
+// only the methods this package actually calls are implemented.
+type fakeProbeDB struct {
+	proto.DB
+	weight   proto.Weight
+	probeErr int32 // atomic bool: nonzero means Probe fails
+}
+
+func (f *fakeProbeDB) Weight() proto.Weight { return f.weight }
+
+func (f *fakeProbeDB) SetWeight(w proto.Weight) error {
+	f.weight = w
+	return nil
+}
+
+func (f *fakeProbeDB) Probe(context.Context, string) error {
+	if atomic.LoadInt32(&f.probeErr) != 0 {
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+func newTestProbe(db *fakeProbeDB, cfg HealthCheckConfig) *healthProbe {
+	if cfg.CircuitBreakN <= 0 {
+		cfg.CircuitBreakN = defaultCircuitBreakN
+	}
+	if cfg.WindowSize <= 0 {
+		cfg.WindowSize = defaultProbeWindow
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultProbeTimeout
+	}
+	return &healthProbe{
+		ns:         &Namespace{name: "healthcheck-test"},
+		group:      "g0",
+		id:         "a",
+		db:         db,
+		cfg:        cfg,
+		origWeight: db.Weight(),
+		haveOrigin: true,
+		stop:       make(chan struct{}),
+	}
+}
+
+// TestHealthProbeOpensCircuitAfterNConsecutiveFailures asserts the circuit
+// opens (and weight is zeroed) only once consecutive failures reach
+// CircuitBreakN, not before.
+func TestHealthProbeOpensCircuitAfterNConsecutiveFailures(t *testing.T) {
+	db := &fakeProbeDB{weight: proto.Weight{R: 10, W: 10}}
+	p := newTestProbe(db, HealthCheckConfig{CircuitBreakN: 3})
+
+	for i := 0; i < 2; i++ {
+		p.record(false, time.Millisecond)
+	}
+	p.mu.Lock()
+	status := p.status
+	p.mu.Unlock()
+	if status == HealthCircuitOpen {
+		t.Fatalf("circuit opened after %d failures, want it to require CircuitBreakN=3", 2)
+	}
+
+	p.record(false, time.Millisecond)
+	p.mu.Lock()
+	status = p.status
+	p.mu.Unlock()
+	if status != HealthCircuitOpen {
+		t.Fatalf("status = %s after 3 consecutive failures, want circuit-open", status)
+	}
+	if db.weight != (proto.Weight{}) {
+		t.Fatalf("weight = %+v with circuit open, want zeroed", db.weight)
+	}
+}
+
+// TestHealthProbeHalfOpenReadmitsOnSuccess asserts a successful half-open
+// probe closes the circuit, restores the original weight, and clears the
+// rolling failure count.
+func TestHealthProbeHalfOpenReadmitsOnSuccess(t *testing.T) {
+	db := &fakeProbeDB{weight: proto.Weight{R: 10, W: 10}}
+	p := newTestProbe(db, HealthCheckConfig{CircuitBreakN: 1})
+
+	p.record(false, time.Millisecond) // opens the circuit
+	p.mu.Lock()
+	if p.status != HealthCircuitOpen {
+		p.mu.Unlock()
+		t.Fatalf("precondition failed: circuit did not open")
+	}
+	p.mu.Unlock()
+
+	p.probeHalfOpen()
+
+	p.mu.Lock()
+	status := p.status
+	fails := p.consecutiveFail
+	p.mu.Unlock()
+
+	if status != HealthHealthy {
+		t.Fatalf("status = %s after a successful half-open probe, want healthy", status)
+	}
+	if fails != 0 {
+		t.Fatalf("consecutiveFail = %d after re-admission, want 0", fails)
+	}
+	if db.weight != (proto.Weight{R: 10, W: 10}) {
+		t.Fatalf("weight = %+v after re-admission, want original restored", db.weight)
+	}
+}
+
+// TestHealthProbeHalfOpenStaysOpenOnFailure asserts a failed half-open
+// probe leaves the circuit open rather than re-admitting the datasource.
+func TestHealthProbeHalfOpenStaysOpenOnFailure(t *testing.T) {
+	db := &fakeProbeDB{weight: proto.Weight{R: 10, W: 10}}
+	p := newTestProbe(db, HealthCheckConfig{CircuitBreakN: 1})
+
+	p.record(false, time.Millisecond) // opens the circuit
+	atomic.StoreInt32(&db.probeErr, 1)
+
+	p.probeHalfOpen()
+
+	p.mu.Lock()
+	status := p.status
+	p.mu.Unlock()
+
+	if status != HealthCircuitOpen {
+		t.Fatalf("status = %s after a failed half-open probe, want it to stay circuit-open", status)
+	}
+	if db.weight != (proto.Weight{}) {
+		t.Fatalf("weight = %+v while circuit stays open, want zeroed", db.weight)
+	}
+}
+
+// TestHealthProbeMaybeHalfOpenRespectsCooldown asserts maybeHalfOpen only
+// issues an admission probe once per HalfOpenInterval, not on every tick.
+func TestHealthProbeMaybeHalfOpenRespectsCooldown(t *testing.T) {
+	db := &fakeProbeDB{weight: proto.Weight{R: 10, W: 10}}
+	p := newTestProbe(db, HealthCheckConfig{CircuitBreakN: 1, HalfOpenInterval: time.Minute})
+
+	p.record(false, time.Millisecond) // opens the circuit
+	atomic.StoreInt32(&db.probeErr, 1)
+
+	now := time.Now()
+	p.maybeHalfOpen(now)
+	p.mu.Lock()
+	firstProbeAt := p.lastHalfOpen
+	p.mu.Unlock()
+
+	// Recovering the datasource must not matter: the second call is still
+	// within the cooldown window, so it must be a no-op.
+	atomic.StoreInt32(&db.probeErr, 0)
+	p.maybeHalfOpen(now.Add(time.Second))
+
+	p.mu.Lock()
+	status := p.status
+	secondProbeAt := p.lastHalfOpen
+	p.mu.Unlock()
+
+	if status != HealthCircuitOpen {
+		t.Fatalf("status = %s after a within-cooldown tick, want it to stay circuit-open", status)
+	}
+	if !secondProbeAt.Equal(firstProbeAt) {
+		t.Fatalf("lastHalfOpen changed on a within-cooldown tick")
+	}
+}
+
+// TestHealthRegistryStopStopsAndForgetsProbe asserts stop closes the
+// probe's stop channel and drops it from the registry, so a later lookup
+// for the same group.id finds nothing and a caller that already holds the
+// probe sees its run loop told to exit.
+func TestHealthRegistryStopStopsAndForgetsProbe(t *testing.T) {
+	ns := &Namespace{name: "healthcheck-test"}
+	db := &fakeProbeDB{weight: proto.Weight{R: 10, W: 10}}
+	p := newTestProbe(db, HealthCheckConfig{})
+	p.ns = ns
+
+	r := healthRegistryOf(ns)
+	r.register("g0", "a", p)
+
+	r.stop("g0", "a")
+
+	select {
+	case <-p.stop:
+	default:
+		t.Fatal("stop channel not closed after healthRegistry.stop")
+	}
+	if len(r.snapshot()) != 0 {
+		t.Fatal("snapshot still reports a probe after healthRegistry.stop")
+	}
+}
+
+// TestHealthRegistryRebindRetargetsProbe asserts rebind swaps the probe's
+// underlying DB (and re-derives origWeight from it) without replacing the
+// registered probe or losing its rolling stats.
+func TestHealthRegistryRebindRetargetsProbe(t *testing.T) {
+	ns := &Namespace{name: "healthcheck-test"}
+	oldDB := &fakeProbeDB{weight: proto.Weight{R: 10, W: 10}}
+	p := newTestProbe(oldDB, HealthCheckConfig{})
+	p.ns = ns
+	p.record(false, time.Millisecond) // leave some rolling state behind
+
+	r := healthRegistryOf(ns)
+	r.register("g0", "a", p)
+
+	newDB := &fakeProbeDB{weight: proto.Weight{R: 5, W: 5}}
+	r.rebind("g0", "a", newDB)
+
+	db, origWeight, haveOrigin := p.current()
+	if db != newDB {
+		t.Fatal("probe still bound to the old DB after rebind")
+	}
+	if !haveOrigin || origWeight != newDB.weight {
+		t.Fatalf("origWeight = %+v, haveOrigin = %v, want %+v, true", origWeight, haveOrigin, newDB.weight)
+	}
+	p.mu.Lock()
+	fails := p.consecutiveFail
+	p.mu.Unlock()
+	if fails != 1 {
+		t.Fatalf("consecutiveFail = %d after rebind, want rolling state preserved", fails)
+	}
+}
+
+// TestHealthRegistryRebindUnknownIsNoop asserts rebinding a group.id that
+// was never registered doesn't panic and leaves the registry empty.
+func TestHealthRegistryRebindUnknownIsNoop(t *testing.T) {
+	ns := &Namespace{name: "healthcheck-test"}
+	r := healthRegistryOf(ns)
+
+	r.rebind("g0", "missing", &fakeProbeDB{})
+
+	if len(r.snapshot()) != 0 {
+		t.Fatal("snapshot reports a probe after rebinding an unknown group.id")
+	}
+}
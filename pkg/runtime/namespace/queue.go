@@ -0,0 +1,356 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package namespace
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+import (
+	"github.com/arana-db/arana/pkg/util/log"
+)
+
+const (
+	defaultQueueWorkers = 4
+	defaultQueueDepth   = 256
+	defaultMaxRetries   = 5
+
+	baseBackoff = 100 * time.Millisecond
+	maxBackoff  = 10 * time.Second
+)
+
+// CommandState describes the lifecycle of a command submitted through
+// Namespace.Submit.
+type CommandState uint8
+
+const (
+	CommandPending CommandState = iota
+	CommandRunning
+	CommandSucceeded
+	CommandFailed
+)
+
+func (s CommandState) String() string {
+	switch s {
+	case CommandRunning:
+		return "running"
+	case CommandSucceeded:
+		return "succeeded"
+	case CommandFailed:
+		return "failed"
+	default:
+		return "pending"
+	}
+}
+
+// CommandStatus is a journal entry recording the outcome of one submitted
+// command, keyed by Kind+Target so the config watcher can observe
+// success/failure instead of it being silently swallowed.
+type CommandStatus struct {
+	Kind      string
+	Target    string
+	Revision  int64
+	State     CommandState
+	Attempts  int
+	LastError error
+	UpdatedAt time.Time
+}
+
+// JournalStore mirrors CommandStatus entries outside of process memory,
+// e.g. into the existing etcd-backed config store, and is consulted by
+// SetJournalStore to repopulate the in-memory journal after a restart, so
+// Namespace.CommandStatus reports the outcome of a command submitted before
+// the process restarted instead of reporting nothing. It does not replay
+// the commands themselves: a Command is an arbitrary Go closure and can't
+// be reconstructed from a persisted CommandStatus, so one still pending
+// when the process exited is simply reported as CommandPending/
+// CommandRunning rather than re-executed; a caller that needs the command
+// itself retried across a restart has to re-Submit it once it observes
+// that state.
+type JournalStore interface {
+	Save(namespace string, status CommandStatus)
+	// Load returns every CommandStatus last persisted for namespace, or
+	// ok=false if nothing was ever saved for it.
+	Load(namespace string) (statuses []CommandStatus, ok bool)
+}
+
+// SubmitOption tags a command submitted through Namespace.Submit.
+type SubmitOption func(*submission)
+
+// WithKind tags the command with a kind, e.g. "upsert_db".
+func WithKind(kind string) SubmitOption {
+	return func(s *submission) { s.kind = kind }
+}
+
+// WithTarget tags the command with the id of the resource it mutates, e.g.
+// "group.id".
+func WithTarget(target string) SubmitOption {
+	return func(s *submission) { s.target = target }
+}
+
+// WithRevision tags the command with the config revision it originated
+// from. A later submission for the same kind+target whose revision is not
+// newer is collapsed as a duplicate. Callers that don't know a revision
+// (e.g. internal callers within this package) can omit this option: Submit
+// then stamps the command with a namespace-local monotonic sequence number,
+// which never collapses against an earlier submission.
+func WithRevision(revision int64) SubmitOption {
+	return func(s *submission) { s.revision = revision }
+}
+
+// WithMaxRetries overrides how many times a transient failure is retried
+// before the command is marked CommandFailed.
+func WithMaxRetries(n int) SubmitOption {
+	return func(s *submission) { s.maxRetry = n }
+}
+
+// noRevision marks a submission whose caller didn't supply WithRevision, so
+// Submit can stamp it with an auto-assigned sequence number instead.
+const noRevision = -1
+
+type submission struct {
+	kind     string
+	target   string
+	revision int64
+	maxRetry int
+}
+
+type job struct {
+	cmd    Command
+	sub    submission
+	status *CommandStatus
+}
+
+// commandQueue runs commands submitted to a Namespace on a bounded worker
+// pool, journals every attempt, and retries transient failures with
+// exponential backoff and jitter.
+type commandQueue struct {
+	ns    *Namespace
+	jobs  chan *job
+	store JournalStore
+	seq   int64 // atomic, next auto-assigned revision
+
+	done     chan struct{}
+	stopOnce sync.Once
+
+	mu      sync.Mutex
+	journal map[string]*CommandStatus // keyed by kind+"."+target
+}
+
+func newCommandQueue(ns *Namespace) *commandQueue {
+	return &commandQueue{
+		ns:      ns,
+		jobs:    make(chan *job, defaultQueueDepth),
+		journal: make(map[string]*CommandStatus),
+		done:    make(chan struct{}),
+	}
+}
+
+// queueOf returns the commandQueue attached to ns, creating and starting it
+// on first use. See namespaceExt for why this is consolidated behind a
+// single per-Namespace extension bundle instead of its own package-level
+// registry.
+func queueOf(ns *Namespace) *commandQueue {
+	e := extOf(ns)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.queue == nil {
+		e.queue = newCommandQueue(ns)
+		e.queue.start()
+	}
+	return e.queue
+}
+
+func journalKey(kind, target string) string {
+	return kind + "." + target
+}
+
+// SetJournalStore registers a durable mirror for this namespace's command
+// journal, e.g. backed by etcd, and immediately replays whatever was last
+// persisted into the in-memory journal, so a freshly started process's
+// CommandStatus reports the outcome of commands submitted before the
+// restart instead of starting empty.
+func (ns *Namespace) SetJournalStore(store JournalStore) {
+	q := queueOf(ns)
+
+	q.mu.Lock()
+	q.store = store
+	q.mu.Unlock()
+
+	statuses, ok := store.Load(ns.name)
+	if !ok {
+		return
+	}
+
+	q.mu.Lock()
+	for i := range statuses {
+		status := statuses[i]
+		q.journal[journalKey(status.Kind, status.Target)] = &status
+	}
+	q.mu.Unlock()
+}
+
+// Async wraps cmd so that invoking it enqueues cmd onto the namespace's
+// command queue (see Submit) instead of applying it synchronously. Use this
+// to opt a specific caller - e.g. the config watcher propagating a change
+// that shouldn't be lost to a momentarily unreachable DB - into queued,
+// retried semantics without changing the synchronous contract of cmd itself
+// for every other caller. opts are forwarded to Submit verbatim, so a
+// caller that knows the config revision a submission originated from should
+// pass WithRevision to get duplicate-collapsing.
+func Async(cmd Command, opts ...SubmitOption) Command {
+	return func(ns *Namespace) error {
+		ns.Submit(cmd, opts...)
+		return nil
+	}
+}
+
+// Submit enqueues cmd for asynchronous execution on a bounded worker pool.
+// Duplicate submissions for the same kind+target whose revision is not
+// newer than what's already pending/succeeded are collapsed, and transient
+// failures are retried with exponential backoff and jitter instead of being
+// silently swallowed.
+func (ns *Namespace) Submit(cmd Command, opts ...SubmitOption) {
+	sub := submission{maxRetry: defaultMaxRetries, revision: noRevision}
+	for _, opt := range opts {
+		opt(&sub)
+	}
+
+	q := queueOf(ns)
+	auto := sub.revision == noRevision
+	if auto {
+		sub.revision = atomic.AddInt64(&q.seq, 1)
+	}
+	key := journalKey(sub.kind, sub.target)
+
+	q.mu.Lock()
+	if existing, ok := q.journal[key]; ok && !auto && existing.State != CommandFailed && sub.revision <= existing.Revision {
+		q.mu.Unlock()
+		log.Infof("[%s] collapsing duplicate command %s.%s at revision %d", ns.name, sub.kind, sub.target, sub.revision)
+		return
+	}
+	status := &CommandStatus{
+		Kind:      sub.kind,
+		Target:    sub.target,
+		Revision:  sub.revision,
+		State:     CommandPending,
+		UpdatedAt: time.Now(),
+	}
+	q.journal[key] = status
+	q.mu.Unlock()
+
+	q.jobs <- &job{cmd: cmd, sub: sub, status: status}
+}
+
+// start launches the queue's worker pool. Called once by queueOf when a
+// Namespace's commandQueue is first created.
+func (q *commandQueue) start() {
+	for i := 0; i < defaultQueueWorkers; i++ {
+		go q.worker()
+	}
+}
+
+func (q *commandQueue) worker() {
+	for {
+		select {
+		case <-q.done:
+			return
+		case j := <-q.jobs:
+			q.run(j)
+		}
+	}
+}
+
+// stop signals every worker goroutine to exit once it finishes any
+// in-flight job. Called from Namespace.Close when ns is being retired;
+// submissions made after stop are not drained, since by then nothing should
+// still be calling Submit against this namespace.
+func (q *commandQueue) stop() {
+	q.stopOnce.Do(func() { close(q.done) })
+}
+
+func (q *commandQueue) run(j *job) {
+	q.setState(j.status, CommandRunning, nil)
+
+	for attempt := 0; ; attempt++ {
+		err := j.cmd(q.ns)
+
+		q.mu.Lock()
+		j.status.Attempts = attempt + 1
+		q.mu.Unlock()
+
+		if err == nil {
+			q.setState(j.status, CommandSucceeded, nil)
+			return
+		}
+
+		if attempt >= j.sub.maxRetry {
+			q.setState(j.status, CommandFailed, err)
+			log.Errorf("[%s] command %s.%s failed permanently after %d attempts: %v", q.ns.name, j.sub.kind, j.sub.target, attempt+1, err)
+			return
+		}
+
+		log.Errorf("[%s] command %s.%s attempt %d failed, retrying: %v", q.ns.name, j.sub.kind, j.sub.target, attempt+1, err)
+		time.Sleep(backoff(attempt))
+	}
+}
+
+func (q *commandQueue) setState(status *CommandStatus, state CommandState, err error) {
+	q.mu.Lock()
+	status.State = state
+	status.LastError = err
+	status.UpdatedAt = time.Now()
+	store := q.store
+	snapshot := *status
+	q.mu.Unlock()
+
+	if store != nil {
+		store.Save(q.ns.name, snapshot)
+	}
+}
+
+// backoff returns a jittered exponential backoff duration for the given
+// zero-based attempt number, capped at maxBackoff.
+func backoff(attempt int) time.Duration {
+	d := baseBackoff << uint(attempt)
+	if d <= 0 || d > maxBackoff {
+		d = maxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d)/2+1))
+}
+
+// CommandStatus returns the current status of every command submitted
+// through Submit, so the config watcher can observe success/failure instead
+// of losing errors.
+func (ns *Namespace) CommandStatus() []CommandStatus {
+	q := queueOf(ns)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	out := make([]CommandStatus, 0, len(q.journal))
+	for _, status := range q.journal {
+		out = append(out, *status)
+	}
+	return out
+}
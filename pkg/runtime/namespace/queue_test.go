@@ -0,0 +1,108 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package namespace
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeJournalStore is an in-memory JournalStore fake for round-trip testing
+// SetJournalStore's replay-on-registration behavior.
+type fakeJournalStore struct {
+	saved map[string][]CommandStatus
+}
+
+func (s *fakeJournalStore) Save(namespace string, status CommandStatus) {
+	if s.saved == nil {
+		s.saved = make(map[string][]CommandStatus)
+	}
+	s.saved[namespace] = append(s.saved[namespace], status)
+}
+
+func (s *fakeJournalStore) Load(namespace string) ([]CommandStatus, bool) {
+	statuses, ok := s.saved[namespace]
+	return statuses, ok
+}
+
+// TestSetJournalStoreReplaysPersistedJournal asserts SetJournalStore
+// repopulates the in-memory journal from whatever the store last persisted,
+// so CommandStatus reports a restart-surviving history instead of starting
+// empty.
+func TestSetJournalStoreReplaysPersistedJournal(t *testing.T) {
+	ns := &Namespace{name: "queue-test"}
+	persisted := CommandStatus{Kind: "upsert_db", Target: "g0.a", Revision: 3, State: CommandFailed}
+
+	store := &fakeJournalStore{saved: map[string][]CommandStatus{
+		ns.name: {persisted},
+	}}
+
+	ns.SetJournalStore(store)
+
+	statuses := ns.CommandStatus()
+	if len(statuses) != 1 {
+		t.Fatalf("CommandStatus() = %v, want exactly the one replayed entry", statuses)
+	}
+	if statuses[0] != persisted {
+		t.Fatalf("CommandStatus()[0] = %+v, want the persisted entry %+v", statuses[0], persisted)
+	}
+}
+
+// TestSetJournalStoreNoopWithoutPriorJournal asserts SetJournalStore against
+// a store that never saw this namespace before leaves the journal empty
+// instead of panicking or fabricating entries.
+func TestSetJournalStoreNoopWithoutPriorJournal(t *testing.T) {
+	ns := &Namespace{name: "queue-test-empty"}
+	store := &fakeJournalStore{}
+
+	ns.SetJournalStore(store)
+
+	if statuses := ns.CommandStatus(); len(statuses) != 0 {
+		t.Fatalf("CommandStatus() = %v, want empty with nothing ever persisted", statuses)
+	}
+}
+
+// TestSubmitPersistsThroughJournalStore asserts a command run through
+// Submit saves its terminal state to the configured JournalStore, so a
+// later SetJournalStore-triggered replay (e.g. after a restart) can see it.
+func TestSubmitPersistsThroughJournalStore(t *testing.T) {
+	ns := &Namespace{name: "queue-test-submit"}
+	store := &fakeJournalStore{}
+	ns.SetJournalStore(store)
+
+	done := make(chan struct{})
+	ns.Submit(func(*Namespace) error {
+		close(done)
+		return nil
+	}, WithKind("noop"), WithTarget("g0.a"))
+
+	<-done
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if statuses, ok := store.Load(ns.name); ok {
+			for _, s := range statuses {
+				if s.Kind == "noop" && s.Target == "g0.a" && s.State == CommandSucceeded {
+					return
+				}
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("JournalStore never observed the command's succeeded state")
+}
@@ -0,0 +1,248 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package namespace
+
+import (
+	"sync"
+	"time"
+)
+
+import (
+	"github.com/arana-db/arana/pkg/util/log"
+)
+
+// RateLimitUnit identifies what a RateLimit's Rate/Burst are measured in.
+type RateLimitUnit uint8
+
+const (
+	// RateLimitQPS limits queries per second.
+	RateLimitQPS RateLimitUnit = iota
+	// RateLimitBytesPerSec limits bytes per second.
+	RateLimitBytesPerSec
+)
+
+func (u RateLimitUnit) String() string {
+	switch u {
+	case RateLimitBytesPerSec:
+		return "bytes/sec"
+	default:
+		return "queries/sec"
+	}
+}
+
+// RateLimit configures a token-bucket throttle for a datasource.
+type RateLimit struct {
+	Unit  RateLimitUnit
+	Rate  float64 // tokens refilled per second
+	Burst float64 // bucket capacity
+}
+
+// emaAlpha is the smoothing factor for the throughput EMA: the higher it
+// is, the more recent samples are weighed.
+const emaAlpha = 0.3
+
+// emaSampleInterval is the cadence at which the Monitor refreshes rEMA.
+const emaSampleInterval = 100 * time.Millisecond
+
+// Monitor guards a single datasource with a token bucket and tracks an
+// exponentially-weighted moving average of its observed throughput, so
+// operators can drive UpdateWeight decisions from real load.
+type Monitor struct {
+	mu sync.Mutex
+
+	limit RateLimit
+
+	tokens     float64
+	lastRefill time.Time
+
+	rEMA        float64
+	windowBytes int64
+	windowStart time.Time
+}
+
+// NewMonitor creates a Monitor enforcing the given RateLimit, with its
+// bucket starting full.
+func NewMonitor(limit RateLimit) *Monitor {
+	now := time.Now()
+	return &Monitor{
+		limit:       limit,
+		tokens:      limit.Burst,
+		lastRefill:  now,
+		windowStart: now,
+	}
+}
+
+// Acquire blocks until n tokens are available, refilling Rate tokens per
+// second up to Burst. With a Rate of zero or less it never blocks: if the
+// bucket can't cover n it returns at once without taking any tokens.
+func (m *Monitor) Acquire(n float64) {
+	for {
+		m.mu.Lock()
+		m.refillLocked()
+		if m.tokens >= n {
+			m.tokens -= n
+			m.mu.Unlock()
+			return
+		}
+		deficit := n - m.tokens
+		rate := m.limit.Rate
+		m.mu.Unlock()
+
+		if rate <= 0 {
+			return
+		}
+		wait := time.Duration(deficit / rate * float64(time.Second))
+		if wait <= 0 {
+			wait = time.Millisecond
+		}
+		time.Sleep(wait)
+	}
+}
+
+func (m *Monitor) refillLocked() {
+	now := time.Now()
+	elapsed := now.Sub(m.lastRefill).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	m.tokens += elapsed * m.limit.Rate
+	if m.tokens > m.limit.Burst {
+		m.tokens = m.limit.Burst
+	}
+	m.lastRefill = now
+}
+
+// Record reports a completed query's size and duration, sampling the
+// exponentially-weighted moving average of observed throughput at a fixed
+// cadence: rEMA = alpha*rSample + (1-alpha)*rEMA.
+func (m *Monitor) Record(bytes int64, duration time.Duration) {
+	_ = duration
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.windowBytes += bytes
+
+	now := time.Now()
+	elapsed := now.Sub(m.windowStart)
+	if elapsed < emaSampleInterval {
+		return
+	}
+
+	rSample := float64(m.windowBytes) / elapsed.Seconds()
+	m.rEMA = emaAlpha*rSample + (1-emaAlpha)*m.rEMA
+	m.windowBytes = 0
+	m.windowStart = now
+}
+
+// EMA returns the current exponentially-weighted moving average of observed
+// throughput, in bytes per second as reported through Record, whatever the
+// Unit of the configured RateLimit.
+func (m *Monitor) EMA() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.rEMA
+}
+
+// rateLimitRegistry holds the Monitor attached to each group.id datasource
+// of a Namespace.
+type rateLimitRegistry struct {
+	mu       sync.Mutex
+	monitors map[string]*Monitor
+}
+
+// rateLimitRegistryOf returns the rateLimitRegistry attached to ns,
+// creating it on first use. See namespaceExt for why this is consolidated
+// behind a single per-Namespace extension bundle instead of its own
+// package-level registry.
+func rateLimitRegistryOf(ns *Namespace) *rateLimitRegistry {
+	e := extOf(ns)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.rateLimit == nil {
+		e.rateLimit = &rateLimitRegistry{monitors: make(map[string]*Monitor)}
+	}
+	return e.rateLimit
+}
+
+func (r *rateLimitRegistry) set(group, id string, m *Monitor) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.monitors[drainKey(group, id)] = m
+}
+
+func (r *rateLimitRegistry) remove(group, id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.monitors, drainKey(group, id))
+}
+
+func (r *rateLimitRegistry) get(group, id string) *Monitor {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.monitors[drainKey(group, id)]
+}
+
+func (r *rateLimitRegistry) stats() map[string]float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := make(map[string]float64, len(r.monitors))
+	for key, m := range r.monitors {
+		out[key] = m.EMA()
+	}
+	return out
+}
+
+// SetRateLimit returns a command that attaches a token-bucket rate limiter
+// to an existing DB, replacing any previous limit set for the same id. The
+// limit is keyed by group+id rather than by DB instance, so it survives a
+// later UpsertDB that re-registers the same id.
+func SetRateLimit(group, id string, limit RateLimit) Command {
+	return func(ns *Namespace) error {
+		rateLimitRegistryOf(ns).set(group, id, NewMonitor(limit))
+		log.Infof("[%s] set rate limit of datasource %s.%s to %.2f %s (burst %.2f)", ns.name, group, id, limit.Rate, limit.Unit, limit.Burst)
+		return nil
+	}
+}
+
+// RemoveRateLimit returns a command that detaches a previously configured
+// rate limit from a DB.
+func RemoveRateLimit(group, id string) Command {
+	return func(ns *Namespace) error {
+		rateLimitRegistryOf(ns).remove(group, id)
+		log.Infof("[%s] removed rate limit of datasource %s.%s", ns.name, group, id)
+		return nil
+	}
+}
+
+// MonitorFor returns the Monitor guarding the given datasource, or nil if
+// none has been configured. Callers in the executor path should call
+// Acquire on it before dispatching a query against that datasource.
+func (ns *Namespace) MonitorFor(group, id string) *Monitor {
+	return rateLimitRegistryOf(ns).get(group, id)
+}
+
+// Stats returns the current throughput EMA of every rate-limited datasource
+// in this namespace, keyed by "group.id", so operators can drive
+// UpdateWeight decisions from real load.
+func (ns *Namespace) Stats() map[string]float64 {
+	return rateLimitRegistryOf(ns).stats()
+}
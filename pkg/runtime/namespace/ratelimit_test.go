@@ -0,0 +1,166 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package namespace
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/arana-db/arana/pkg/proto"
+)
+
+// TestMonitorAcquireBlocksUntilRefilled asserts Acquire blocks a caller that
+// asks for more tokens than are currently in the bucket until enough have
+// been refilled at Rate tokens/sec.
+func TestMonitorAcquireBlocksUntilRefilled(t *testing.T) {
+	m := NewMonitor(RateLimit{Unit: RateLimitQPS, Rate: 100, Burst: 1})
+
+	m.Acquire(1) // drains the initial burst
+
+	start := time.Now()
+	m.Acquire(1) // needs ~10ms of refill at 100/sec
+	elapsed := time.Since(start)
+
+	if elapsed < 5*time.Millisecond {
+		t.Fatalf("Acquire returned after %s, want it to block for refill", elapsed)
+	}
+}
+
+// TestMonitorAcquireNeverBlocksWithinBurst asserts Acquire is immediate as
+// long as the request stays within the current token balance.
+func TestMonitorAcquireNeverBlocksWithinBurst(t *testing.T) {
+	m := NewMonitor(RateLimit{Unit: RateLimitQPS, Rate: 10, Burst: 5})
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		m.Acquire(1)
+	}
+	elapsed := time.Since(start)
+
+	if elapsed > 20*time.Millisecond {
+		t.Fatalf("Acquire within burst took %s, want it to return immediately", elapsed)
+	}
+}
+
+// TestMonitorAcquireConcurrent asserts concurrent Acquire callers never
+// collectively draw more tokens than Burst plus what Rate refilled over the
+// run, i.e. the bucket itself never races.
+func TestMonitorAcquireConcurrent(t *testing.T) {
+	m := NewMonitor(RateLimit{Unit: RateLimitQPS, Rate: 1000, Burst: 20})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.Acquire(1)
+		}()
+	}
+	wg.Wait()
+
+	m.mu.Lock()
+	tokens := m.tokens
+	m.mu.Unlock()
+
+	if tokens < -1 {
+		t.Fatalf("tokens went negative beyond rounding: %v", tokens)
+	}
+}
+
+// TestMonitorEMATracksThroughput asserts Record updates the EMA once a full
+// sample interval has elapsed, and leaves it untouched before that.
+func TestMonitorEMATracksThroughput(t *testing.T) {
+	m := NewMonitor(RateLimit{Unit: RateLimitBytesPerSec, Rate: 1 << 20, Burst: 1 << 20})
+
+	m.Record(1024, time.Millisecond)
+	if got := m.EMA(); got != 0 {
+		t.Fatalf("EMA = %v before a full sample interval elapsed, want 0", got)
+	}
+
+	m.windowStart = time.Now().Add(-emaSampleInterval - time.Millisecond)
+	m.Record(1024, time.Millisecond)
+
+	if got := m.EMA(); got <= 0 {
+		t.Fatalf("EMA = %v after a full sample interval elapsed, want > 0", got)
+	}
+}
+
+// TestRateLimitRegistryRemoveIsScopedToId asserts a Monitor registered via
+// SetRateLimit is still reachable by MonitorFor/Stats after RemoveRateLimit
+// on an unrelated id, and is gone once removed for its own id.
+func TestRateLimitRegistryRemoveIsScopedToId(t *testing.T) {
+	ns := &Namespace{name: "ratelimit-test"}
+
+	if err := SetRateLimit("g0", "a", RateLimit{Unit: RateLimitQPS, Rate: 10, Burst: 10})(ns); err != nil {
+		t.Fatalf("SetRateLimit: %v", err)
+	}
+
+	if ns.MonitorFor("g0", "a") == nil {
+		t.Fatal("MonitorFor returned nil right after SetRateLimit")
+	}
+	if _, ok := ns.Stats()["g0.a"]; !ok {
+		t.Fatal("Stats() missing freshly-set rate limit")
+	}
+
+	if err := RemoveRateLimit("g0", "b")(ns); err != nil {
+		t.Fatalf("RemoveRateLimit: %v", err)
+	}
+	if ns.MonitorFor("g0", "a") == nil {
+		t.Fatal("MonitorFor(g0, a) was cleared by an unrelated RemoveRateLimit(g0, b)")
+	}
+
+	if err := RemoveRateLimit("g0", "a")(ns); err != nil {
+		t.Fatalf("RemoveRateLimit: %v", err)
+	}
+	if ns.MonitorFor("g0", "a") != nil {
+		t.Fatal("MonitorFor(g0, a) still returns a Monitor after RemoveRateLimit")
+	}
+}
+
+// TestRateLimitRegistrySurvivesUpsert asserts a Monitor registered via
+// SetRateLimit for a group/id is still the one MonitorFor returns after
+// UpsertDB replaces the underlying proto.DB for that same group/id, since
+// the limit is keyed by group+id rather than by DB instance and must
+// survive the DB it was configured against being displaced.
+func TestRateLimitRegistrySurvivesUpsert(t *testing.T) {
+	const group = "g0"
+	const id = "a"
+
+	ns := &Namespace{name: "ratelimit-test"}
+	ns.dss.Store(map[string][]proto.DB{group: {&fakeDrainDB{id: id}}})
+
+	if err := SetRateLimit(group, id, RateLimit{Unit: RateLimitQPS, Rate: 10, Burst: 10})(ns); err != nil {
+		t.Fatalf("SetRateLimit: %v", err)
+	}
+
+	original := ns.MonitorFor(group, id)
+	if original == nil {
+		t.Fatal("MonitorFor returned nil right after SetRateLimit")
+	}
+
+	if err := UpsertDB(group, &fakeDrainDB{id: id})(ns); err != nil {
+		t.Fatalf("UpsertDB: %v", err)
+	}
+
+	if got := ns.MonitorFor(group, id); got != original {
+		t.Fatalf("MonitorFor(%s, %s) = %p after UpsertDB, want the original Monitor %p to survive", group, id, got, original)
+	}
+}
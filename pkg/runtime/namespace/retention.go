@@ -0,0 +1,415 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package namespace
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+import (
+	"github.com/arana-db/arana/pkg/proto"
+	"github.com/arana-db/arana/pkg/util/log"
+)
+
+// defaultSweepInterval is the sweeper's poll granularity, and also the
+// per-table re-scan cadence used for a policy that doesn't specify its own
+// ShardGroupDuration. A policy's ShardGroupDuration can only lengthen the
+// effective cadence beyond this granularity, not shorten it below a poll.
+const defaultSweepInterval = 5 * time.Minute
+
+// RetentionAction is the action taken against a physical shard once its
+// window has aged past the policy's Duration.
+type RetentionAction uint8
+
+const (
+	// RetentionDrop simply drops the aged-out physical shard.
+	RetentionDrop RetentionAction = iota
+	// RetentionArchive copies the shard's rows into ArchiveGroup before
+	// dropping it.
+	RetentionArchive
+	// RetentionReadOnly leaves the shard's data in place but stops new
+	// writes from landing on it.
+	RetentionReadOnly
+)
+
+func (a RetentionAction) String() string {
+	switch a {
+	case RetentionArchive:
+		return "archive-to-db"
+	case RetentionReadOnly:
+		return "read-only"
+	default:
+		return "drop"
+	}
+}
+
+// RetentionPolicy mirrors the retention-policy model used by time-series
+// metadata systems: data older than Duration is subject to Action, and new
+// shard groups are expected to span ShardGroupDuration with ReplicaN
+// replicas.
+type RetentionPolicy struct {
+	Duration           time.Duration
+	ShardGroupDuration time.Duration
+	ReplicaN           int
+	Action             RetentionAction
+	// ArchiveGroup is the cold-storage datasource group rows are copied
+	// into when Action is RetentionArchive. It must already be registered
+	// via UpsertDB.
+	ArchiveGroup string
+}
+
+// ShardWindow describes the time range covered by one physical shard of a
+// sharded logical table.
+type ShardWindow struct {
+	LogicalTable string
+	Physical     string
+	Group        string
+	ID           string
+	End          time.Time
+}
+
+// ShardEnumerator discovers the physical shards backing a logical table, so
+// the retention sweeper can identify aged-out shards without this package
+// needing to know sharding-algorithm internals. It is registered per
+// namespace through SetShardEnumerator, the same way PolicyStore/
+// JournalStore are wired in, rather than being derived from the sharding
+// rule: the rule type lives in another package entirely and isn't
+// guaranteed to implement this interface itself.
+type ShardEnumerator interface {
+	EnumerateShards(logicalTable string) ([]ShardWindow, error)
+}
+
+// RowCopier is implemented by proto.DB backends capable of copying a
+// physical shard's rows into another datasource, as used by the
+// archive-to-DB retention action.
+type RowCopier interface {
+	CopyTo(ctx context.Context, dest proto.DB, physicalTable string) error
+}
+
+// Dropper is implemented by proto.DB backends capable of dropping a
+// physical shard outright.
+type Dropper interface {
+	DropShard(ctx context.Context, physicalTable string) error
+}
+
+// ReadOnlyMarker is implemented by proto.DB backends capable of rejecting
+// further writes against a single physical shard while leaving it
+// otherwise queryable, as used by the read-only retention action.
+type ReadOnlyMarker interface {
+	MarkReadOnly(ctx context.Context, physicalTable string) error
+}
+
+// PolicyStore mirrors a namespace's retention policy set outside of process
+// memory, e.g. into the existing etcd-backed config store, so the policy
+// set survives a restart and can be reloaded on UpdateRule instead of
+// living only in the in-memory retentionRegistry.
+type PolicyStore interface {
+	Save(namespace string, policies map[string]RetentionPolicy, assigned map[string]string)
+	Load(namespace string) (policies map[string]RetentionPolicy, assigned map[string]string, ok bool)
+}
+
+type retentionRegistry struct {
+	mu         sync.Mutex
+	policies   map[string]RetentionPolicy
+	assigned   map[string]string    // logicalTable -> policy name
+	lastSwept  map[string]time.Time // logicalTable -> time of its last sweep
+	store      PolicyStore
+	enumerator ShardEnumerator
+	startOnce  sync.Once
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+}
+
+// retentionRegistryOf returns the retentionRegistry attached to ns, creating
+// it on first use. See namespaceExt for why this is consolidated behind a
+// single per-Namespace extension bundle instead of its own package-level
+// registry.
+func retentionRegistryOf(ns *Namespace) *retentionRegistry {
+	e := extOf(ns)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.retention == nil {
+		e.retention = &retentionRegistry{
+			policies:  make(map[string]RetentionPolicy),
+			assigned:  make(map[string]string),
+			lastSwept: make(map[string]time.Time),
+			stopCh:    make(chan struct{}),
+		}
+	}
+	return e.retention
+}
+
+func (r *retentionRegistry) upsertPolicy(ns *Namespace, name string, rp RetentionPolicy) {
+	r.mu.Lock()
+	r.policies[name] = rp
+	r.persistLocked(ns)
+	r.mu.Unlock()
+}
+
+func (r *retentionRegistry) policy(name string) (RetentionPolicy, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rp, ok := r.policies[name]
+	return rp, ok
+}
+
+func (r *retentionRegistry) assign(ns *Namespace, logicalTable, policyName string) {
+	r.mu.Lock()
+	r.assigned[logicalTable] = policyName
+	r.persistLocked(ns)
+	r.mu.Unlock()
+}
+
+// persistLocked mirrors the current policy set to the configured
+// PolicyStore, if any. Callers must hold r.mu.
+func (r *retentionRegistry) persistLocked(ns *Namespace) {
+	if r.store == nil {
+		return
+	}
+
+	policies := make(map[string]RetentionPolicy, len(r.policies))
+	for k, v := range r.policies {
+		policies[k] = v
+	}
+	assigned := make(map[string]string, len(r.assigned))
+	for k, v := range r.assigned {
+		assigned[k] = v
+	}
+	r.store.Save(ns.name, policies, assigned)
+}
+
+// reload re-populates the policy set from the configured PolicyStore, so
+// that a restart or an UpdateRule-triggered reconfiguration picks back up
+// whatever was last persisted instead of starting empty.
+func (r *retentionRegistry) reload(ns *Namespace) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.store == nil {
+		return
+	}
+	policies, assigned, ok := r.store.Load(ns.name)
+	if !ok {
+		return
+	}
+	r.policies = policies
+	r.assigned = assigned
+	r.lastSwept = make(map[string]time.Time)
+
+	if len(r.assigned) > 0 {
+		r.startOnce.Do(func() { go sweepLoop(ns, r) })
+	}
+}
+
+// due reports whether table hasn't been swept within interval, and if so
+// marks it as swept as of now. interval is the policy's ShardGroupDuration
+// when set, or defaultSweepInterval otherwise, so a policy can opt into
+// re-scanning its tables on its own cadence instead of the package default.
+func (r *retentionRegistry) due(table string, now time.Time, interval time.Duration) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if last, ok := r.lastSwept[table]; ok && now.Sub(last) < interval {
+		return false
+	}
+	r.lastSwept[table] = now
+	return true
+}
+
+func (r *retentionRegistry) snapshot() map[string]RetentionPolicy {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := make(map[string]RetentionPolicy, len(r.assigned))
+	for table, name := range r.assigned {
+		if rp, ok := r.policies[name]; ok {
+			out[table] = rp
+		}
+	}
+	return out
+}
+
+func (r *retentionRegistry) ensureSweeper(ns *Namespace) {
+	r.startOnce.Do(func() {
+		go sweepLoop(ns, r)
+	})
+}
+
+func sweepLoop(ns *Namespace, r *retentionRegistry) {
+	ticker := time.NewTicker(defaultSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stopCh:
+			return
+		case <-ticker.C:
+			sweepOnce(ns, r)
+		}
+	}
+}
+
+// stop halts the background sweep loop, if one was ever started. Called
+// from Namespace.Close when ns is being retired.
+func (r *retentionRegistry) stop() {
+	r.stopOnce.Do(func() { close(r.stopCh) })
+}
+
+func sweepOnce(ns *Namespace, r *retentionRegistry) {
+	r.mu.Lock()
+	enumerator := r.enumerator
+	r.mu.Unlock()
+
+	if enumerator == nil {
+		log.Infof("[%s] retention sweep: no ShardEnumerator configured, skipping", ns.name)
+		return
+	}
+
+	now := time.Now()
+	for table, rp := range r.snapshot() {
+		interval := rp.ShardGroupDuration
+		if interval <= 0 {
+			interval = defaultSweepInterval
+		}
+		if !r.due(table, now, interval) {
+			continue
+		}
+
+		shards, err := enumerator.EnumerateShards(table)
+		if err != nil {
+			log.Errorf("[%s] retention sweep: failed to enumerate shards of %s: %v", ns.name, table, err)
+			continue
+		}
+
+		for _, shard := range shards {
+			if now.Sub(shard.End) < rp.Duration {
+				continue
+			}
+			if err := applyRetentionAction(ns, rp, shard); err != nil {
+				log.Errorf("[%s] retention sweep: failed to apply %s to shard %s: %v", ns.name, rp.Action, shard.Physical, err)
+				continue
+			}
+			log.Infof("[%s] retention sweep: applied %s to shard %s of table %s", ns.name, rp.Action, shard.Physical, table)
+		}
+	}
+}
+
+func applyRetentionAction(ns *Namespace, rp RetentionPolicy, shard ShardWindow) error {
+	dss := ns.dss.Load().(map[string][]proto.DB)
+
+	var source proto.DB
+	if exist, ok := dss[shard.Group]; ok {
+		for _, it := range exist {
+			if it.ID() == shard.ID {
+				source = it
+				break
+			}
+		}
+	}
+	if source == nil {
+		return fmt.Errorf("no such datasource %s.%s backing shard %s", shard.Group, shard.ID, shard.Physical)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultDrainTimeout)
+	defer cancel()
+
+	switch rp.Action {
+	case RetentionReadOnly:
+		marker, ok := source.(ReadOnlyMarker)
+		if !ok {
+			return fmt.Errorf("datasource %s.%s cannot mark shards read-only", shard.Group, shard.ID)
+		}
+		return marker.MarkReadOnly(ctx, shard.Physical)
+	case RetentionArchive:
+		cold, ok := dss[rp.ArchiveGroup]
+		if !ok || len(cold) == 0 {
+			return fmt.Errorf("archive group %s is not registered", rp.ArchiveGroup)
+		}
+		copier, ok := source.(RowCopier)
+		if !ok {
+			return fmt.Errorf("datasource %s.%s cannot copy shards for archival", shard.Group, shard.ID)
+		}
+		if err := copier.CopyTo(ctx, cold[0], shard.Physical); err != nil {
+			return fmt.Errorf("archive shard %s: %w", shard.Physical, err)
+		}
+		fallthrough
+	default: // RetentionDrop
+		dropper, ok := source.(Dropper)
+		if !ok {
+			return fmt.Errorf("datasource %s.%s cannot drop shards", shard.Group, shard.ID)
+		}
+		return dropper.DropShard(ctx, shard.Physical)
+	}
+}
+
+// SetPolicyStore registers a durable mirror for this namespace's retention
+// policy set, e.g. backed by the existing etcd config store, so policies
+// survive a restart and UpdateRule can reload them. It does not affect
+// in-memory semantics.
+func (ns *Namespace) SetPolicyStore(store PolicyStore) {
+	retentionRegistryOf(ns).store = store
+}
+
+// SetShardEnumerator registers the ShardEnumerator the retention sweeper
+// uses to discover the physical shards backing a logical table. The
+// sweeper is a no-op until this is called; there's no implicit derivation
+// from the namespace's sharding rule.
+func (ns *Namespace) SetShardEnumerator(e ShardEnumerator) {
+	r := retentionRegistryOf(ns)
+	r.mu.Lock()
+	r.enumerator = e
+	r.mu.Unlock()
+}
+
+// UpsertRetentionPolicy returns a command that creates or replaces a named
+// retention policy. The policy only takes effect once assigned to a
+// logical table via ApplyRetentionPolicy. The updated policy set is
+// persisted through the configured PolicyStore, if any.
+func UpsertRetentionPolicy(name string, rp RetentionPolicy) Command {
+	return func(ns *Namespace) error {
+		retentionRegistryOf(ns).upsertPolicy(ns, name, rp)
+		log.Infof("[%s] upsert retention policy %s successfully", ns.name, name)
+		return nil
+	}
+}
+
+// ApplyRetentionPolicy returns a command that assigns an existing retention
+// policy to a logical sharded table and starts the background sweeper for
+// this namespace if it isn't already running. The updated assignment is
+// persisted through the configured PolicyStore, if any.
+func ApplyRetentionPolicy(logicalTable, policyName string) Command {
+	return func(ns *Namespace) error {
+		reg := retentionRegistryOf(ns)
+
+		if _, ok := reg.policy(policyName); !ok {
+			return fmt.Errorf("no such retention policy %s", policyName)
+		}
+		reg.assign(ns, logicalTable, policyName)
+		reg.ensureSweeper(ns)
+
+		log.Infof("[%s] apply retention policy %s to table %s successfully", ns.name, policyName, logicalTable)
+
+		return nil
+	}
+}
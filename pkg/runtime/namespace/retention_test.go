@@ -0,0 +1,353 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package namespace
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/arana-db/arana/pkg/proto"
+)
+
+// fakeRetentionDB is a minimal proto.DB fake implementing the optional
+// RowCopier/Dropper/ReadOnlyMarker capabilities used by
+// applyRetentionAction.
+type fakeRetentionDB struct {
+	proto.DB
+	id string
+
+	copyErr  error
+	dropErr  error
+	markErr  error
+	copied   []string
+	dropped  []string
+	markedRO []string
+}
+
+func (f *fakeRetentionDB) ID() string { return f.id }
+
+func (f *fakeRetentionDB) CopyTo(_ context.Context, _ proto.DB, physicalTable string) error {
+	if f.copyErr != nil {
+		return f.copyErr
+	}
+	f.copied = append(f.copied, physicalTable)
+	return nil
+}
+
+func (f *fakeRetentionDB) DropShard(_ context.Context, physicalTable string) error {
+	if f.dropErr != nil {
+		return f.dropErr
+	}
+	f.dropped = append(f.dropped, physicalTable)
+	return nil
+}
+
+func (f *fakeRetentionDB) MarkReadOnly(_ context.Context, physicalTable string) error {
+	if f.markErr != nil {
+		return f.markErr
+	}
+	f.markedRO = append(f.markedRO, physicalTable)
+	return nil
+}
+
+func newRetentionTestNamespace(group, id string, db *fakeRetentionDB) *Namespace {
+	ns := &Namespace{name: "retention-test"}
+	ns.dss.Store(map[string][]proto.DB{group: {db}})
+	return ns
+}
+
+// TestApplyRetentionActionDrop asserts RetentionDrop calls DropShard and
+// nothing else.
+func TestApplyRetentionActionDrop(t *testing.T) {
+	db := &fakeRetentionDB{id: "a"}
+	ns := newRetentionTestNamespace("g0", "a", db)
+
+	shard := ShardWindow{LogicalTable: "t", Physical: "t_0", Group: "g0", ID: "a"}
+	if err := applyRetentionAction(ns, RetentionPolicy{Action: RetentionDrop}, shard); err != nil {
+		t.Fatalf("applyRetentionAction: %v", err)
+	}
+	if len(db.dropped) != 1 || db.dropped[0] != "t_0" {
+		t.Fatalf("dropped = %v, want [t_0]", db.dropped)
+	}
+	if len(db.copied) != 0 {
+		t.Fatalf("copied = %v, want none for a plain drop", db.copied)
+	}
+}
+
+// TestApplyRetentionActionArchive asserts RetentionArchive copies to the
+// archive group before dropping the source shard.
+func TestApplyRetentionActionArchive(t *testing.T) {
+	source := &fakeRetentionDB{id: "a"}
+	cold := &fakeRetentionDB{id: "cold"}
+
+	ns := &Namespace{name: "retention-test"}
+	ns.dss.Store(map[string][]proto.DB{
+		"g0":      {source},
+		"archive": {cold},
+	})
+
+	shard := ShardWindow{LogicalTable: "t", Physical: "t_0", Group: "g0", ID: "a"}
+	rp := RetentionPolicy{Action: RetentionArchive, ArchiveGroup: "archive"}
+	if err := applyRetentionAction(ns, rp, shard); err != nil {
+		t.Fatalf("applyRetentionAction: %v", err)
+	}
+	if len(source.copied) != 1 || source.copied[0] != "t_0" {
+		t.Fatalf("copied = %v, want [t_0]", source.copied)
+	}
+	if len(source.dropped) != 1 || source.dropped[0] != "t_0" {
+		t.Fatalf("dropped = %v, want [t_0] after archiving", source.dropped)
+	}
+}
+
+// TestApplyRetentionActionArchiveStopsOnCopyError asserts a failed copy
+// never falls through to dropping the still-needed source shard.
+func TestApplyRetentionActionArchiveStopsOnCopyError(t *testing.T) {
+	source := &fakeRetentionDB{id: "a", copyErr: errors.New("copy failed")}
+	cold := &fakeRetentionDB{id: "cold"}
+
+	ns := &Namespace{name: "retention-test"}
+	ns.dss.Store(map[string][]proto.DB{
+		"g0":      {source},
+		"archive": {cold},
+	})
+
+	shard := ShardWindow{LogicalTable: "t", Physical: "t_0", Group: "g0", ID: "a"}
+	rp := RetentionPolicy{Action: RetentionArchive, ArchiveGroup: "archive"}
+	if err := applyRetentionAction(ns, rp, shard); err == nil {
+		t.Fatal("applyRetentionAction returned nil, want the copy error")
+	}
+	if len(source.dropped) != 0 {
+		t.Fatalf("dropped = %v, want nothing dropped when archival copy fails", source.dropped)
+	}
+}
+
+// TestApplyRetentionActionReadOnly asserts RetentionReadOnly marks the
+// shard read-only and never drops or copies it.
+func TestApplyRetentionActionReadOnly(t *testing.T) {
+	db := &fakeRetentionDB{id: "a"}
+	ns := newRetentionTestNamespace("g0", "a", db)
+
+	shard := ShardWindow{LogicalTable: "t", Physical: "t_0", Group: "g0", ID: "a"}
+	if err := applyRetentionAction(ns, RetentionPolicy{Action: RetentionReadOnly}, shard); err != nil {
+		t.Fatalf("applyRetentionAction: %v", err)
+	}
+	if len(db.markedRO) != 1 || db.markedRO[0] != "t_0" {
+		t.Fatalf("markedRO = %v, want [t_0]", db.markedRO)
+	}
+	if len(db.dropped) != 0 {
+		t.Fatalf("dropped = %v, want nothing dropped for read-only", db.dropped)
+	}
+}
+
+// TestApplyRetentionActionUnsupportedCapability asserts the action fails
+// loudly, instead of silently no-oping, when the backing DB doesn't
+// implement the capability the action needs.
+func TestApplyRetentionActionUnsupportedCapability(t *testing.T) {
+	db := &fakeRetentionDB{id: "a"}
+	ns := newRetentionTestNamespace("g0", "a", db)
+	shard := ShardWindow{LogicalTable: "t", Physical: "t_0", Group: "g0", ID: "a"}
+
+	// fakeRetentionDB implements ReadOnlyMarker/RowCopier/Dropper, so swap
+	// in a bare fake that implements none of them.
+	bare := &fakeDrainDB{id: "a"}
+	ns.dss.Store(map[string][]proto.DB{"g0": {bare}})
+
+	if err := applyRetentionAction(ns, RetentionPolicy{Action: RetentionReadOnly}, shard); err == nil {
+		t.Fatal("applyRetentionAction returned nil for a DB without ReadOnlyMarker, want an error")
+	}
+}
+
+// TestRetentionRegistryUpsertAndAssign asserts UpsertRetentionPolicy and
+// ApplyRetentionPolicy populate the registry snapshot consulted by the
+// sweeper.
+func TestRetentionRegistryUpsertAndAssign(t *testing.T) {
+	ns := &Namespace{name: "retention-test"}
+
+	rp := RetentionPolicy{Duration: time.Hour, Action: RetentionDrop}
+	if err := UpsertRetentionPolicy("hourly", rp)(ns); err != nil {
+		t.Fatalf("UpsertRetentionPolicy: %v", err)
+	}
+	if err := ApplyRetentionPolicy("t", "hourly")(ns); err != nil {
+		t.Fatalf("ApplyRetentionPolicy: %v", err)
+	}
+
+	snap := retentionRegistryOf(ns).snapshot()
+	got, ok := snap["t"]
+	if !ok {
+		t.Fatal("snapshot missing assigned table \"t\"")
+	}
+	if got != rp {
+		t.Fatalf("snapshot[\"t\"] = %+v, want %+v", got, rp)
+	}
+}
+
+// TestApplyRetentionPolicyUnknownPolicy asserts assigning a never-upserted
+// policy name fails instead of silently assigning nothing.
+func TestApplyRetentionPolicyUnknownPolicy(t *testing.T) {
+	ns := &Namespace{name: "retention-test"}
+	if err := ApplyRetentionPolicy("t", "missing")(ns); err == nil {
+		t.Fatal("ApplyRetentionPolicy returned nil for an unknown policy, want an error")
+	}
+}
+
+// fakeShardEnumerator is an in-memory ShardEnumerator fake for exercising
+// sweepOnce end-to-end without a real sharding rule.
+type fakeShardEnumerator struct {
+	shards map[string][]ShardWindow
+}
+
+func (f *fakeShardEnumerator) EnumerateShards(logicalTable string) ([]ShardWindow, error) {
+	return f.shards[logicalTable], nil
+}
+
+// TestSweepOnceAppliesActionToAgedShards asserts sweepOnce, driven through a
+// registered ShardEnumerator, enumerates the shards backing every assigned
+// table and applies the policy's action to whichever ones are older than
+// its Duration, leaving shards that aren't aged out alone.
+func TestSweepOnceAppliesActionToAgedShards(t *testing.T) {
+	db := &fakeRetentionDB{id: "a"}
+	ns := newRetentionTestNamespace("g0", "a", db)
+
+	rp := RetentionPolicy{Duration: time.Hour, Action: RetentionDrop}
+	if err := UpsertRetentionPolicy("hourly", rp)(ns); err != nil {
+		t.Fatalf("UpsertRetentionPolicy: %v", err)
+	}
+	if err := ApplyRetentionPolicy("t", "hourly")(ns); err != nil {
+		t.Fatalf("ApplyRetentionPolicy: %v", err)
+	}
+
+	aged := ShardWindow{LogicalTable: "t", Physical: "t_aged", Group: "g0", ID: "a", End: time.Now().Add(-2 * time.Hour)}
+	fresh := ShardWindow{LogicalTable: "t", Physical: "t_fresh", Group: "g0", ID: "a", End: time.Now()}
+	ns.SetShardEnumerator(&fakeShardEnumerator{shards: map[string][]ShardWindow{
+		"t": {aged, fresh},
+	}})
+
+	sweepOnce(ns, retentionRegistryOf(ns))
+
+	if len(db.dropped) != 1 || db.dropped[0] != "t_aged" {
+		t.Fatalf("dropped = %v, want exactly the aged shard t_aged", db.dropped)
+	}
+}
+
+// TestSweepOnceNoopWithoutEnumerator asserts sweepOnce does nothing (and
+// doesn't panic) when no ShardEnumerator has been registered yet.
+func TestSweepOnceNoopWithoutEnumerator(t *testing.T) {
+	db := &fakeRetentionDB{id: "a"}
+	ns := newRetentionTestNamespace("g0", "a", db)
+
+	rp := RetentionPolicy{Duration: time.Hour, Action: RetentionDrop}
+	if err := UpsertRetentionPolicy("hourly", rp)(ns); err != nil {
+		t.Fatalf("UpsertRetentionPolicy: %v", err)
+	}
+	if err := ApplyRetentionPolicy("t", "hourly")(ns); err != nil {
+		t.Fatalf("ApplyRetentionPolicy: %v", err)
+	}
+
+	sweepOnce(ns, retentionRegistryOf(ns))
+
+	if len(db.dropped) != 0 {
+		t.Fatalf("dropped = %v, want nothing dropped without a registered ShardEnumerator", db.dropped)
+	}
+}
+
+// TestRetentionRegistryDueGatesOnShardGroupDuration asserts due() only
+// lets a table through once the interval it is given (sweepOnce passes the
+// policy's ShardGroupDuration) has elapsed since its last sweep.
+func TestRetentionRegistryDueGatesOnShardGroupDuration(t *testing.T) {
+	r := &retentionRegistry{
+		policies:  make(map[string]RetentionPolicy),
+		assigned:  make(map[string]string),
+		lastSwept: make(map[string]time.Time),
+	}
+
+	now := time.Now()
+	if !r.due("t", now, time.Minute) {
+		t.Fatal("due() = false on the first check, want true")
+	}
+	if r.due("t", now.Add(30*time.Second), time.Minute) {
+		t.Fatal("due() = true before the interval elapsed, want false")
+	}
+	if !r.due("t", now.Add(time.Minute+time.Second), time.Minute) {
+		t.Fatal("due() = false after the interval elapsed, want true")
+	}
+}
+
+// fakePolicyStore is an in-memory PolicyStore fake for round-trip testing
+// UpsertRetentionPolicy/ApplyRetentionPolicy persistence and reload.
+type fakePolicyStore struct {
+	policies map[string]RetentionPolicy
+	assigned map[string]string
+}
+
+func (s *fakePolicyStore) Save(_ string, policies map[string]RetentionPolicy, assigned map[string]string) {
+	s.policies = policies
+	s.assigned = assigned
+}
+
+func (s *fakePolicyStore) Load(_ string) (map[string]RetentionPolicy, map[string]string, bool) {
+	if s.policies == nil {
+		return nil, nil, false
+	}
+	return s.policies, s.assigned, true
+}
+
+// TestRetentionPolicyPersistAndReload asserts a policy set written through
+// UpsertRetentionPolicy/ApplyRetentionPolicy round-trips through the
+// configured PolicyStore and repopulates a fresh registry on reload.
+func TestRetentionPolicyPersistAndReload(t *testing.T) {
+	store := &fakePolicyStore{}
+	ns := &Namespace{name: "retention-test"}
+	ns.SetPolicyStore(store)
+
+	rp := RetentionPolicy{Duration: time.Hour, Action: RetentionDrop}
+	if err := UpsertRetentionPolicy("hourly", rp)(ns); err != nil {
+		t.Fatalf("UpsertRetentionPolicy: %v", err)
+	}
+	if err := ApplyRetentionPolicy("t", "hourly")(ns); err != nil {
+		t.Fatalf("ApplyRetentionPolicy: %v", err)
+	}
+
+	if store.policies["hourly"] != rp {
+		t.Fatalf("store.policies[hourly] = %+v, want %+v", store.policies["hourly"], rp)
+	}
+	if store.assigned["t"] != "hourly" {
+		t.Fatalf("store.assigned[t] = %q, want hourly", store.assigned["t"])
+	}
+
+	// Simulate a restart: a brand new registry for the same Namespace
+	// pointer, wired to the same store, should reload what was persisted.
+	e := extOf(ns)
+	e.mu.Lock()
+	e.retention = nil
+	e.mu.Unlock()
+	reg := retentionRegistryOf(ns)
+	reg.store = store
+	reg.reload(ns)
+
+	if got, ok := reg.policy("hourly"); !ok || got != rp {
+		t.Fatalf("policy(hourly) after reload = %+v, %v, want %+v, true", got, ok, rp)
+	}
+	snap := reg.snapshot()
+	if snap["t"] != rp {
+		t.Fatalf("snapshot[t] after reload = %+v, want %+v", snap["t"], rp)
+	}
+}